@@ -12,14 +12,20 @@ import (
 )
 
 func AdminListVideosHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(
+	order := videoSorts["new"]
+	page, err := parsePageParams(r, order)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	query, params := paginateQuery(
 		`SELECT
 			v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
 			v.created_at, v.user_id, COALESCE(u.name,''),
 			v.category_id, COALESCE(c.name,''),
             (SELECT COUNT(*) FROM likes l WHERE l.video_id = v.id)            AS likes_count,
             (SELECT COUNT(*) FROM dislikes d WHERE d.video_id = v.id)         AS dislikes_count,
-			(SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id)         AS comments_count,
+			(SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id AND NOT m.is_deleted) AS comments_count,
 			COALESCE((SELECT AVG(value) FROM ratings r WHERE r.video_id = v.id),0) AS avg_rating,
 			v.is_approved,
 			(v.video_path_720 IS NOT NULL AND v.video_path_720 <> '') AS has_720,
@@ -28,8 +34,8 @@ func AdminListVideosHandler(w http.ResponseWriter, r *http.Request) {
                 FROM videos v
                 JOIN users u ON u.id = v.user_id
                 LEFT JOIN categories c ON c.id = v.category_id
-                WHERE v.is_approved = FALSE
-                ORDER BY v.created_at DESC`)
+                WHERE v.is_approved = FALSE`, nil, order, page)
+	rows, err := db.Query(query, params...)
 	if err != nil {
 		http.Error(w, "Ошибка получения видео", http.StatusInternalServerError)
 		return
@@ -60,8 +66,8 @@ func AdminListVideosHandler(w http.ResponseWriter, r *http.Request) {
 		videos = append(videos, v)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(videos)
+	videos, next := trimPage(videos, order, page)
+	writeVideoPage(w, videos, next, page)
 }
 
 func AdminApproveVideoHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,6 +82,9 @@ func AdminApproveVideoHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Видео не найдено", http.StatusNotFound)
 		return
 	}
+	relatedCache.Clear()
+	go addSearchTerms(id)
+	go evaluateSavedSearches(id)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"message": "Видео одобрено"})
 }
@@ -294,6 +303,7 @@ func AdminCreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	if req.ParentID != nil {
 		created.ParentID = req.ParentID
 	}
+	categoryCache.Clear()
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(created)
@@ -371,6 +381,7 @@ func AdminUpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка обновления", http.StatusInternalServerError)
 		return
 	}
+	categoryCache.Clear()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"id": newID, "name": newName, "parent_id": func() *int {
 		if parent.Valid {
@@ -404,6 +415,7 @@ func AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Категория не найдена", http.StatusNotFound)
 		return
 	}
+	categoryCache.Clear()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
@@ -475,6 +487,7 @@ func AdminMoveCategoryParentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	categoryCache.Clear()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "parent_id": req.ParentID})
 }
@@ -522,6 +535,7 @@ func AdminReorderCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	categoryCache.Clear()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "position": newPos})
 }
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -110,6 +112,13 @@ func clientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
+// clientKey identifies an anonymous client by a hash of IP and user agent, e.g. to attribute
+// search clicks without storing the address itself.
+func clientKey(r *http.Request) string {
+	sum := sha256.Sum256([]byte(clientIP(r) + "|" + r.UserAgent()))
+	return hex.EncodeToString(sum[:16])
+}
+
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
@@ -147,6 +156,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка базы данных", http.StatusInternalServerError)
 		return
 	}
+	assignDefaultHandle(id)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{"message": "Регистрация успешна", "user_id": id})
 }
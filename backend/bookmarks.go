@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
+)
+
+// Bookmark lists kept apart from likes, so that saving a video does not count as a like.
+const (
+	listFavorites  = "favorites"
+	listWatchLater = "watch_later"
+)
+
+// setVideoBookmark adds the video to (or removes it from) one of the user's lists (idempotent).
+func setVideoBookmark(w http.ResponseWriter, r *http.Request, list string, add bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var err error
+	if add {
+		_, err = db.Exec("INSERT INTO video_bookmarks (user_id, video_id, list) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING", uid, id, list)
+		if pe, ok := err.(*pq.Error); ok && pe.Code.Name() == "foreign_key_violation" {
+			http.Error(w, "Видео не найдено", http.StatusNotFound)
+			return
+		}
+	} else {
+		_, err = db.Exec("DELETE FROM video_bookmarks WHERE user_id=$1 AND video_id=$2 AND list=$3", uid, id, list)
+	}
+	if err != nil {
+		log.Printf("setVideoBookmark: list=%s user=%d video=%d: %v", list, uid, id, err)
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	field := "favorited"
+	if list == listWatchLater {
+		field = "in_watch_later"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"video_id": id, field: add})
+}
+
+func FavoriteVideoHandler(w http.ResponseWriter, r *http.Request) {
+	setVideoBookmark(w, r, listFavorites, true)
+}
+
+func UnfavoriteVideoHandler(w http.ResponseWriter, r *http.Request) {
+	setVideoBookmark(w, r, listFavorites, false)
+}
+
+func AddWatchLaterHandler(w http.ResponseWriter, r *http.Request) {
+	setVideoBookmark(w, r, listWatchLater, true)
+}
+
+func RemoveWatchLaterHandler(w http.ResponseWriter, r *http.Request) {
+	setVideoBookmark(w, r, listWatchLater, false)
+}
+
+// BookmarkItem is a saved video with the time it was saved.
+type BookmarkItem struct {
+	Video   Video     `json:"video"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// listVideoBookmarks writes one of the user's lists, most recently saved first (offset cursor).
+func listVideoBookmarks(w http.ResponseWriter, r *http.Request, list string) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	offsets, err := decodeOffsetCursor(r.URL.Query().Get("cursor"), list, 1)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	rows, err := db.Query(`SELECT `+videoListColumns+`, b.created_at,
+            EXISTS (SELECT 1 FROM video_bookmarks o WHERE o.user_id = b.user_id AND o.video_id = v.id AND o.list <> b.list)
+        FROM video_bookmarks b
+        JOIN videos v ON v.id = b.video_id
+        `+videoListJoins+`
+        WHERE b.user_id = $1 AND b.list = $2 AND v.is_approved = TRUE
+        ORDER BY b.created_at DESC, v.id DESC
+        LIMIT `+strconv.Itoa(limit+1)+` OFFSET `+strconv.Itoa(offsets[0]), uid, list)
+	if err != nil {
+		log.Printf("listVideoBookmarks: query error list=%s user=%d: %v", list, uid, err)
+		http.Error(w, "Ошибка получения видео", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []BookmarkItem{}
+	for rows.Next() {
+		var it BookmarkItem
+		var inOther bool
+		if err := scanVideo(rows, &it.Video, &it.SavedAt, &inOther); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		if list == listFavorites {
+			it.Video.Favorited, it.Video.InWatchLater = true, inOther
+		} else {
+			it.Video.Favorited, it.Video.InWatchLater = inOther, true
+		}
+		out = append(out, it)
+	}
+	next := ""
+	if len(out) > limit {
+		out = out[:limit]
+		next = encodeOffsetCursor(list, offsets[0]+limit)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": out, "next_cursor": next})
+}
+
+func ListFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	listVideoBookmarks(w, r, listFavorites)
+}
+
+func ListWatchLaterHandler(w http.ResponseWriter, r *http.Request) {
+	listVideoBookmarks(w, r, listWatchLater)
+}
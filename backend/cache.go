@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache is a small in-process cache for encoded JSON responses.
+type ttlCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	items      map[string]ttlCacheEntry
+}
+
+type ttlCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func newTTLCache(ttl time.Duration, maxEntries int) *ttlCache {
+	return &ttlCache{ttl: ttl, maxEntries: maxEntries, items: map[string]ttlCacheEntry{}}
+}
+
+func (c *ttlCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.items, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.items) >= c.maxEntries {
+		// drop expired entries first, everything if still full
+		now := time.Now()
+		for k, e := range c.items {
+			if now.After(e.expires) {
+				delete(c.items, k)
+			}
+		}
+		if len(c.items) >= c.maxEntries {
+			c.items = map[string]ttlCacheEntry{}
+		}
+	}
+	c.items[key] = ttlCacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// Clear drops all entries, e.g. after the underlying data changed.
+func (c *ttlCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = map[string]ttlCacheEntry{}
+}
@@ -2,9 +2,67 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
 )
 
+// categorySubtreeSQL selects the ids of the categories in arr (an int[] placeholder) and all
+// their descendants. UNION instead of UNION ALL keeps it finite even if the tree has a cycle.
+func categorySubtreeSQL(arr string) string {
+	return `WITH RECURSIVE sub AS (
+                SELECT id FROM categories WHERE id = ANY(` + arr + `::int[])
+                UNION
+                SELECT ch.id FROM categories ch JOIN sub ON ch.parent_id = sub.id
+            ) SELECT id FROM sub`
+}
+
+// CategoryFacet is the number of matching videos in the subtree of one child category.
+type CategoryFacet struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// categoryFacets counts the videos of a filtered listing query (inner, with its params) per
+// direct child of the selected categories, each child including its own descendants.
+func categoryFacets(inner string, params []any, selected []int64) ([]CategoryFacet, error) {
+	params = append(params, pq.Array(selected))
+	rows, err := db.Query(`WITH RECURSIVE ch AS (
+                SELECT id, name, position FROM categories
+                WHERE parent_id = ANY($`+strconv.Itoa(len(params))+`::int[])
+            ),
+            tree AS (
+                SELECT id AS root, id FROM ch
+                UNION
+                SELECT t.root, c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+            )
+            SELECT ch.id, ch.name, COUNT(DISTINCT f.id)
+            FROM ch
+            JOIN tree ON tree.root = ch.id
+            LEFT JOIN (`+inner+`) f ON f.category_id = tree.id
+            GROUP BY ch.id, ch.name, ch.position
+            ORDER BY ch.position ASC, ch.name ASC`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []CategoryFacet{}
+	for rows.Next() {
+		var f CategoryFacet
+		if err := rows.Scan(&f.ID, &f.Name, &f.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
 func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query("SELECT id, name, parent_id FROM categories ORDER BY name ASC")
 	if err != nil {
@@ -31,3 +89,148 @@ func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(list)
 }
+
+// categoryCache holds encoded tree and breadcrumb responses. Admin category changes clear it;
+// the TTL keeps the video counts reasonably fresh.
+var categoryCache = newTTLCache(5*time.Minute, 2000)
+
+// CategoryNode is one node of the public category tree. Count is the number of approved videos
+// filed directly under the category, Total also includes all descendants.
+type CategoryNode struct {
+	ID       int             `json:"id"`
+	Name     string          `json:"name"`
+	ParentID *int            `json:"parent_id"`
+	Position int             `json:"position"`
+	Count    int             `json:"count"`
+	Total    int             `json:"total"`
+	Children []*CategoryNode `json:"children"`
+}
+
+// buildCategoryTree nests a flat list already sorted by position and name. Nodes whose parent is
+// missing, or that are part of a cycle, are attached to the root level.
+func buildCategoryTree(flat []*CategoryNode) []*CategoryNode {
+	byID := make(map[int]*CategoryNode, len(flat))
+	for _, n := range flat {
+		n.Children = []*CategoryNode{}
+		byID[n.ID] = n
+	}
+	inCycle := func(n *CategoryNode) bool {
+		seen := map[int]bool{n.ID: true}
+		for p := n.ParentID; p != nil; {
+			parent, ok := byID[*p]
+			if !ok {
+				return false
+			}
+			if seen[parent.ID] {
+				return true
+			}
+			seen[parent.ID] = true
+			p = parent.ParentID
+		}
+		return false
+	}
+	roots := []*CategoryNode{}
+	for _, n := range flat {
+		if n.ParentID != nil {
+			if parent, ok := byID[*n.ParentID]; ok && !inCycle(n) {
+				parent.Children = append(parent.Children, n)
+				continue
+			}
+		}
+		roots = append(roots, n)
+	}
+	var sum func(n *CategoryNode) int
+	sum = func(n *CategoryNode) int {
+		n.Total = n.Count
+		for _, c := range n.Children {
+			n.Total += sum(c)
+		}
+		return n.Total
+	}
+	for _, n := range roots {
+		sum(n)
+	}
+	return roots
+}
+
+// writeCachedJSON serves key from categoryCache, or encodes build()'s result and caches it.
+func writeCachedJSON(w http.ResponseWriter, key string, build func() (any, int, error)) {
+	body, ok := categoryCache.Get(key)
+	if !ok {
+		v, status, err := build()
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if body, err = json.Marshal(v); err != nil {
+			http.Error(w, "Ошибка формирования ответа", http.StatusInternalServerError)
+			return
+		}
+		body = append(body, '\n')
+		categoryCache.Set(key, body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// CategoryTreeHandler returns all categories nested by parent, siblings in admin-defined order.
+func CategoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	writeCachedJSON(w, "tree", func() (any, int, error) {
+		rows, err := db.Query(`SELECT c.id, c.name, c.parent_id, c.position,
+                (SELECT COUNT(*) FROM videos v WHERE v.category_id = c.id AND v.is_approved = TRUE)
+            FROM categories c
+            ORDER BY c.position ASC, c.name ASC`)
+		if err != nil {
+			log.Printf("CategoryTreeHandler: query error: %v", err)
+			return nil, http.StatusInternalServerError, errors.New("Ошибка получения категорий")
+		}
+		defer rows.Close()
+		flat := []*CategoryNode{}
+		for rows.Next() {
+			n := &CategoryNode{}
+			if err := rows.Scan(&n.ID, &n.Name, &n.ParentID, &n.Position, &n.Count); err != nil {
+				return nil, http.StatusInternalServerError, errors.New("Ошибка БД")
+			}
+			flat = append(flat, n)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, http.StatusInternalServerError, errors.New("Ошибка БД")
+		}
+		return buildCategoryTree(flat), 0, nil
+	})
+}
+
+// CategoryBreadcrumbsHandler returns the path from the root category down to the given one.
+func CategoryBreadcrumbsHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	writeCachedJSON(w, "breadcrumbs:"+strconv.Itoa(id), func() (any, int, error) {
+		// depth is bounded to guard against cycles
+		rows, err := db.Query(`WITH RECURSIVE up AS (
+                SELECT id, name, parent_id, 0 AS lvl FROM categories WHERE id=$1
+                UNION ALL
+                SELECT c.id, c.name, c.parent_id, up.lvl + 1 FROM categories c JOIN up ON c.id = up.parent_id
+                WHERE up.lvl < 10
+            ) SELECT id, name FROM up ORDER BY lvl DESC`, id)
+		if err != nil {
+			log.Printf("CategoryBreadcrumbsHandler: query error id=%d: %v", id, err)
+			return nil, http.StatusInternalServerError, errors.New("Ошибка получения категорий")
+		}
+		defer rows.Close()
+		type crumb struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+		out := []crumb{}
+		for rows.Next() {
+			var c crumb
+			if err := rows.Scan(&c.ID, &c.Name); err != nil {
+				return nil, http.StatusInternalServerError, errors.New("Ошибка БД")
+			}
+			out = append(out, c)
+		}
+		if len(out) == 0 {
+			return nil, http.StatusNotFound, errors.New("Категория не найдена")
+		}
+		return out, 0, nil
+	})
+}
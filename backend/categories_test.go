@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestBuildCategoryTree(t *testing.T) {
+	p := func(i int) *int { return &i }
+	flat := []*CategoryNode{
+		{ID: 1, Name: "Одежда", Count: 2},
+		{ID: 3, Name: "Обувь", ParentID: p(1), Count: 1},
+		{ID: 2, Name: "Платья", ParentID: p(1), Count: 4},
+		{ID: 4, Name: "Кеды", ParentID: p(3), Count: 5},
+		{ID: 5, Name: "Сирота", ParentID: p(99)},
+		{ID: 6, Name: "A", ParentID: p(7)},
+		{ID: 7, Name: "B", ParentID: p(6)},
+	}
+	roots := buildCategoryTree(flat)
+	if len(roots) != 4 || roots[0].ID != 1 {
+		t.Fatalf("unexpected roots: %d", len(roots))
+	}
+	if c := roots[0].Children; len(c) != 2 || c[0].ID != 3 || c[1].ID != 2 {
+		t.Fatalf("children should keep input order: %+v", c)
+	}
+	if roots[0].Total != 12 || roots[0].Children[0].Total != 6 {
+		t.Fatalf("unexpected totals: %d %d", roots[0].Total, roots[0].Children[0].Total)
+	}
+}
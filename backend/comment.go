@@ -1,73 +1,498 @@
-
 package main
 
 import (
-    "encoding/json"
-    "net/http"
-    "strconv"
-    "strings"
-    "time"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-    "github.com/gorilla/mux"
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
 )
 
+// maxCommentDepth is the deepest reply level; replies to such comments join the same thread.
+const maxCommentDepth = 2
+
 type Comment struct {
-    ID        int    `json:"id"`
-    Text      string `json:"text"`
-    CreatedAt string `json:"created_at"`
-    User      struct {
-        ID   int    `json:"id"`
-        Name string `json:"name"`
-    } `json:"user"`
+	ID         int    `json:"id"`
+	Text       string `json:"text"`
+	CreatedAt  string `json:"created_at"`
+	ParentID   *int   `json:"parent_id,omitempty"`
+	ReplyCount int    `json:"reply_count"`
+	LikesCount int    `json:"likes_count"`
+	LikedByMe  bool   `json:"liked_by_me"`
+	// Pinned is the one comment the video owner (or an admin) put on top
+	Pinned bool `json:"pinned"`
+	// Hearted marks comments the video owner liked
+	Hearted  bool    `json:"hearted"`
+	Edited   bool    `json:"edited"`
+	EditedAt *string `json:"edited_at,omitempty"`
+	// Deleted marks a placeholder kept so that the replies below it stay readable
+	Deleted bool `json:"deleted,omitempty"`
+	// Entities are the resolved @mentions of Text
+	Entities []CommentEntity `json:"entities,omitempty"`
+	// exact timestamp for cursors; CreatedAt drops sub-second precision
+	createdAt time.Time
+	User      struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"user"`
+}
+
+// comments of deleted accounts stay with user_id NULL and come out with user {0, ""}
+const commentColumns = `c.id, c.text, c.created_at, c.parent_id, c.is_deleted, COALESCE(u.id, 0) AS user_id, COALESCE(u.name,''),
+        (SELECT COUNT(*) FROM comments rc WHERE rc.parent_id = c.id) AS reply_count,
+        (SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = c.id) AS likes,
+        COALESCE(cv.pinned_comment_id = c.id, FALSE) AS pinned,
+        c.hearted_at IS NOT NULL AS hearted,
+        c.edited_at`
+
+const commentFrom = `FROM comments c LEFT JOIN users u ON u.id=c.user_id JOIN videos cv ON cv.id=c.video_id`
+
+// commentSorts are the keyset orderings of comment lists (columns of the wrapped query x).
+var commentSorts = map[string]listSort{
+	"oldest": {Name: "oldest", Keys: []sortKey{{Column: "x.created_at", Cast: "timestamp"}, {Column: "x.id", Cast: "int"}}},
+	"newest": {Name: "newest", Keys: []sortKey{{Column: "x.created_at", Cast: "timestamp", Desc: true}, {Column: "x.id", Cast: "int", Desc: true}}},
+	"top": {Name: "top", Keys: []sortKey{{Column: "x.likes", Cast: "bigint", Desc: true},
+		{Column: "x.created_at", Cast: "timestamp", Desc: true}, {Column: "x.id", Cast: "int", Desc: true}}},
+}
+
+// trimComments drops the look-ahead row and returns the cursor for the following page.
+func trimComments(items []Comment, sort listSort, p pageParams) ([]Comment, string) {
+	if p.Limit <= 0 || len(items) <= p.Limit {
+		return items, ""
+	}
+	items = items[:p.Limit]
+	last := items[len(items)-1]
+	c := listCursor{Sort: sort.Name, Values: make([]string, len(sort.Keys))}
+	for i, k := range sort.Keys {
+		switch k.Column {
+		case "x.likes":
+			c.Values[i] = strconv.Itoa(last.LikesCount)
+		case "x.created_at":
+			c.Values[i] = last.createdAt.Format("2006-01-02T15:04:05.999999")
+		default:
+			c.Values[i] = strconv.Itoa(last.ID)
+		}
+	}
+	return items, encodeCursor(c)
 }
 
+// writeCommentPage writes {"items","next_cursor"}, or a bare array for legacy clients.
+func writeCommentPage(w http.ResponseWriter, items []Comment, next string, p pageParams) {
+	w.Header().Set("Content-Type", "application/json")
+	if p.Legacy {
+		if next != "" {
+			w.Header().Set("X-Next-Cursor", next)
+		}
+		_ = json.NewEncoder(w).Encode(items)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": items, "next_cursor": next})
+}
+
+func scanComments(rows *sql.Rows) ([]Comment, error) {
+	defer rows.Close()
+	out := []Comment{}
+	for rows.Next() {
+		var c Comment
+		var t time.Time
+		var parent sql.NullInt32
+		var edited sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Text, &t, &parent, &c.Deleted, &c.User.ID, &c.User.Name, &c.ReplyCount,
+			&c.LikesCount, &c.Pinned, &c.Hearted, &edited); err != nil {
+			return nil, err
+		}
+		if edited.Valid {
+			e := edited.Time.Format(time.RFC3339)
+			c.Edited, c.EditedAt = true, &e
+		}
+		c.CreatedAt = t.Format(time.RFC3339)
+		c.createdAt = t
+		if parent.Valid {
+			p := int(parent.Int32)
+			c.ParentID = &p
+		}
+		if c.Deleted {
+			c.Text = ""
+			c.User.ID, c.User.Name = 0, ""
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// markLikedComments sets LikedByMe for comments liked by the request's user, if any.
+func markLikedComments(r *http.Request, comments []Comment) {
+	uid, ok := r.Context().Value(ctxKeyUserID).(int)
+	if !ok || len(comments) == 0 {
+		return
+	}
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = int64(c.ID)
+	}
+	rows, err := db.Query("SELECT comment_id FROM comment_likes WHERE user_id=$1 AND comment_id = ANY($2::int[])", uid, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	liked := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			liked[id] = true
+		}
+	}
+	for i := range comments {
+		comments[i].LikedByMe = liked[comments[i].ID]
+	}
+}
+
+// ListCommentsHandler returns the top-level comments of a video with keyset pagination; replies
+// are paged separately. ?sort=oldest (default), newest or top (likes); the pinned comment comes
+// first on the first page. legacy=1 returns a bare array (next page in X-Next-Cursor).
 func ListCommentsHandler(w http.ResponseWriter, r *http.Request) {
-    vid, _ := strconv.Atoi(mux.Vars(r)["id"])
-    rows, err := db.Query(`SELECT c.id, c.text, c.created_at, u.id, COALESCE(u.name,'')
-                           FROM comments c JOIN users u ON u.id=c.user_id
-                           WHERE c.video_id=$1 ORDER BY c.created_at ASC`, vid)
-    if err != nil { http.Error(w,"Ошибка получения комментариев",http.StatusInternalServerError); return }
-    defer rows.Close()
-    out := []Comment{}
-    for rows.Next() {
-        var c Comment; var t time.Time; var uid int; var name string
-        if err := rows.Scan(&c.ID,&c.Text,&t,&uid,&name); err != nil { http.Error(w,"Ошибка БД",http.StatusInternalServerError); return }
-        c.CreatedAt = t.Format(time.RFC3339)
-        c.User.ID = uid; c.User.Name = name
-        out = append(out, c)
-    }
-    w.Header().Set("Content-Type","application/json")
-    json.NewEncoder(w).Encode(out)
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	sort, ok := commentSorts[r.URL.Query().Get("sort")]
+	if !ok {
+		sort = commentSorts["oldest"]
+	}
+	page, err := parsePageParams(r, sort)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	query, params := paginateQuery(`SELECT `+commentColumns+`
+                           `+commentFrom+`
+                           WHERE c.video_id=$1 AND c.parent_id IS NULL
+                             AND cv.pinned_comment_id IS DISTINCT FROM c.id`, []any{vid}, sort, page)
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		http.Error(w, "Ошибка получения комментариев", http.StatusInternalServerError)
+		return
+	}
+	out, err := scanComments(rows)
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	out, next := trimComments(out, sort, page)
+	if page.Cursor == nil {
+		rows, err := db.Query(`SELECT `+commentColumns+` `+commentFrom+`
+            WHERE c.video_id=$1 AND cv.pinned_comment_id = c.id`, vid)
+		if err == nil {
+			var pinned []Comment
+			if pinned, err = scanComments(rows); err == nil {
+				out = append(pinned, out...)
+			}
+		}
+		if err != nil {
+			http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+			return
+		}
+	}
+	markLikedComments(r, out)
+	attachCommentEntities(out)
+	writeCommentPage(w, out, next, page)
+}
+
+// ListCommentRepliesHandler pages through the direct replies of a comment, oldest first.
+func ListCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	cid, _ := strconv.Atoi(mux.Vars(r)["commentId"])
+	sort := commentSorts["oldest"]
+	page, err := parsePageParams(r, sort)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM comments WHERE id=$1 AND video_id=$2)", cid, vid).Scan(&exists); err != nil || !exists {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	query, params := paginateQuery(`SELECT `+commentColumns+`
+        `+commentFrom+`
+        WHERE c.parent_id=$1`, []any{cid}, sort, page)
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		http.Error(w, "Ошибка получения комментариев", http.StatusInternalServerError)
+		return
+	}
+	out, err := scanComments(rows)
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	out, next := trimComments(out, sort, page)
+	markLikedComments(r, out)
+	attachCommentEntities(out)
+	writeCommentPage(w, out, next, page)
 }
 
 func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
-    vid, _ := strconv.Atoi(mux.Vars(r)["id"])
-    var req struct{ Text string `json:"text"` }
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w,"Некорректный формат",http.StatusBadRequest); return }
-    if strings.TrimSpace(req.Text) == "" { http.Error(w,"Текст пуст",http.StatusBadRequest); return }
-    uid := r.Context().Value(ctxKeyUserID).(int)
-    var id int; var created time.Time
-    if err := db.QueryRow("INSERT INTO comments (video_id,user_id,text) VALUES ($1,$2,$3) RETURNING id, created_at", vid, uid, req.Text).Scan(&id, &created); err != nil {
-        http.Error(w,"Ошибка сохранения",http.StatusInternalServerError); return
-    }
-    var name string; _ = db.QueryRow("SELECT COALESCE(name,'') FROM users WHERE id=$1", uid).Scan(&name)
-    c := Comment{ID:id, Text:req.Text, CreatedAt:created.Format(time.RFC3339)}
-    c.User.ID = uid; c.User.Name = name
-    w.Header().Set("Content-Type","application/json")
-    json.NewEncoder(w).Encode(c)
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var req struct {
+		Text     string `json:"text"`
+		ParentID *int   `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректный формат", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "Текст пуст", http.StatusBadRequest)
+		return
+	}
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var parentID sql.NullInt32
+	depth := 0
+	if req.ParentID != nil {
+		var pDepth int
+		var pParent sql.NullInt32
+		var pDeleted bool
+		if err := db.QueryRow("SELECT depth, parent_id, is_deleted FROM comments WHERE id=$1 AND video_id=$2", *req.ParentID, vid).Scan(&pDepth, &pParent, &pDeleted); err != nil || pDeleted {
+			http.Error(w, "Комментарий не найден", http.StatusNotFound)
+			return
+		}
+		parentID = sql.NullInt32{Int32: int32(*req.ParentID), Valid: true}
+		depth = pDepth + 1
+		if pDepth >= maxCommentDepth {
+			// too deep: answer within the same thread
+			parentID, depth = pParent, pDepth
+		}
+	}
+	var id int
+	var created time.Time
+	if err := db.QueryRow("INSERT INTO comments (video_id,user_id,text,parent_id,depth) VALUES ($1,$2,$3,$4,$5) RETURNING id, created_at", vid, uid, req.Text, parentID, depth).Scan(&id, &created); err != nil {
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+	entities, err := syncCommentMentions(id, vid, uid, req.Text)
+	if err != nil {
+		log.Printf("CreateCommentHandler: mentions of comment %d: %v", id, err)
+	}
+	var name string
+	_ = db.QueryRow("SELECT COALESCE(name,'') FROM users WHERE id=$1", uid).Scan(&name)
+	c := Comment{ID: id, Text: req.Text, CreatedAt: created.Format(time.RFC3339), Entities: entities}
+	if parentID.Valid {
+		p := int(parentID.Int32)
+		c.ParentID = &p
+	}
+	c.User.ID = uid
+	c.User.Name = name
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
 }
 
+// DeleteCommentHandler removes a comment. A comment with replies becomes a placeholder instead;
+// placeholders left without replies are removed as well.
 func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
-    vid, _ := strconv.Atoi(mux.Vars(r)["id"])
-    cid, _ := strconv.Atoi(mux.Vars(r)["commentId"])
-    var author int
-    if err := db.QueryRow("SELECT user_id FROM comments WHERE id=$1 AND video_id=$2", cid, vid).Scan(&author); err != nil {
-        http.Error(w,"Комментарий не найден",http.StatusNotFound); return
-    }
-    uid := r.Context().Value(ctxKeyUserID).(int)
-    role := r.Context().Value(ctxKeyUserRole).(string)
-    if uid != author && role != "admin" { http.Error(w,"Нет прав",http.StatusForbidden); return }
-    if _, err := db.Exec("DELETE FROM comments WHERE id=$1", cid); err != nil { http.Error(w,"Ошибка удаления",http.StatusInternalServerError); return }
-    w.Header().Set("Content-Type","application/json")
-    json.NewEncoder(w).Encode(map[string]string{"message":"Комментарий удален"})
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	cid, _ := strconv.Atoi(mux.Vars(r)["commentId"])
+	var author int
+	var parent sql.NullInt32
+	if err := db.QueryRow("SELECT COALESCE(user_id, 0), parent_id FROM comments WHERE id=$1 AND video_id=$2 AND is_deleted=FALSE", cid, vid).Scan(&author, &parent); err != nil {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	role := r.Context().Value(ctxKeyUserRole).(string)
+	if uid != author && role != "admin" {
+		http.Error(w, "Нет прав", http.StatusForbidden)
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Ошибка удаления", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var hasReplies bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM comments WHERE parent_id=$1)", cid).Scan(&hasReplies); err != nil {
+		http.Error(w, "Ошибка удаления", http.StatusInternalServerError)
+		return
+	}
+	if hasReplies {
+		_, err = tx.Exec("UPDATE comments SET is_deleted=TRUE, text='', hearted_at=NULL WHERE id=$1", cid)
+		if err == nil {
+			_, err = tx.Exec("UPDATE videos SET pinned_comment_id=NULL WHERE pinned_comment_id=$1", cid)
+		}
+	} else {
+		_, err = tx.Exec("DELETE FROM comments WHERE id=$1", cid)
+		// walk up and drop placeholders that no longer have replies
+		for err == nil && parent.Valid {
+			var next sql.NullInt32
+			var deleted bool
+			if err = tx.QueryRow("SELECT parent_id, is_deleted FROM comments WHERE id=$1", parent.Int32).Scan(&next, &deleted); err != nil || !deleted {
+				if err == sql.ErrNoRows {
+					err = nil
+				}
+				break
+			}
+			var res sql.Result
+			res, err = tx.Exec(`DELETE FROM comments p WHERE p.id=$1
+                AND NOT EXISTS (SELECT 1 FROM comments c WHERE c.parent_id=p.id)`, parent.Int32)
+			if err != nil {
+				break
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				break
+			}
+			parent = next
+		}
+	}
+	if err != nil || tx.Commit() != nil {
+		http.Error(w, "Ошибка удаления", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Комментарий удален"})
+}
+
+// commentTarget loads a comment of the video from the route together with the video owner.
+func commentTarget(r *http.Request) (vid, cid, videoOwner int, parent sql.NullInt32, err error) {
+	vid, _ = strconv.Atoi(mux.Vars(r)["id"])
+	cid, _ = strconv.Atoi(mux.Vars(r)["commentId"])
+	err = db.QueryRow(`SELECT v.user_id, c.parent_id FROM comments c JOIN videos v ON v.id = c.video_id
+        WHERE c.id=$1 AND c.video_id=$2 AND c.is_deleted=FALSE`, cid, vid).Scan(&videoOwner, &parent)
+	return
+}
+
+func writeCommentLikes(w http.ResponseWriter, cid int, liked bool) {
+	var count int
+	_ = db.QueryRow("SELECT COUNT(*) FROM comment_likes WHERE comment_id=$1", cid).Scan(&count)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": cid, "liked": liked, "likes_count": count})
+}
+
+// LikeCommentHandler likes a comment (idempotent).
+func LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	_, cid, _, _, err := commentTarget(r)
+	if err != nil {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	if _, err := db.Exec("INSERT INTO comment_likes (user_id, comment_id) VALUES ($1,$2) ON CONFLICT DO NOTHING", uid, cid); err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	writeCommentLikes(w, cid, true)
+}
+
+// UnlikeCommentHandler removes the current user's like (idempotent).
+func UnlikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	cid, _ := strconv.Atoi(mux.Vars(r)["commentId"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	if _, err := db.Exec("DELETE FROM comment_likes WHERE user_id=$1 AND comment_id=$2", uid, cid); err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	writeCommentLikes(w, cid, false)
+}
+
+// PinCommentHandler pins a top-level comment (PUT) or unpins it (DELETE); video owner or admin only.
+func PinCommentHandler(w http.ResponseWriter, r *http.Request) {
+	vid, cid, owner, parent, err := commentTarget(r)
+	if err != nil {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	role := r.Context().Value(ctxKeyUserRole).(string)
+	if uid != owner && role != "admin" {
+		http.Error(w, "Нет прав", http.StatusForbidden)
+		return
+	}
+	pin := r.Method != http.MethodDelete
+	if pin && parent.Valid {
+		http.Error(w, "Закрепить можно только комментарий верхнего уровня", http.StatusBadRequest)
+		return
+	}
+	if pin {
+		_, err = db.Exec("UPDATE videos SET pinned_comment_id=$1 WHERE id=$2", cid, vid)
+	} else {
+		_, err = db.Exec("UPDATE videos SET pinned_comment_id=NULL WHERE id=$1 AND pinned_comment_id=$2", vid, cid)
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": cid, "pinned": pin})
+}
+
+// HeartCommentHandler sets (PUT) or removes (DELETE) the video owner's heart on a comment.
+func HeartCommentHandler(w http.ResponseWriter, r *http.Request) {
+	_, cid, owner, _, err := commentTarget(r)
+	if err != nil {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	if uid := r.Context().Value(ctxKeyUserID).(int); uid != owner {
+		http.Error(w, "Нет прав", http.StatusForbidden)
+		return
+	}
+	hearted := r.Method != http.MethodDelete
+	if hearted {
+		_, err = db.Exec("UPDATE comments SET hearted_at=COALESCE(hearted_at, NOW()) WHERE id=$1", cid)
+	} else {
+		_, err = db.Exec("UPDATE comments SET hearted_at=NULL WHERE id=$1", cid)
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": cid, "hearted": hearted})
+}
+
+// AdminCommentHistoryHandler returns the current text of a comment and its previous versions, newest first.
+func AdminCommentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	cid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var text string
+	var edited sql.NullTime
+	if err := db.QueryRow("SELECT text, edited_at FROM comments WHERE id=$1", cid).Scan(&text, &edited); err != nil {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	rows, err := db.Query(`SELECT e.id, e.old_text, e.edited_at, COALESCE(e.edited_by, 0), COALESCE(u.name,'')
+        FROM comment_edits e LEFT JOIN users u ON u.id = e.edited_by
+        WHERE e.comment_id=$1 ORDER BY e.edited_at DESC, e.id DESC`, cid)
+	if err != nil {
+		http.Error(w, "Ошибка получения истории", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type edit struct {
+		ID       int    `json:"id"`
+		OldText  string `json:"old_text"`
+		EditedAt string `json:"edited_at"`
+		EditedBy struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"edited_by"`
+	}
+	history := []edit{}
+	for rows.Next() {
+		var e edit
+		var t time.Time
+		if err := rows.Scan(&e.ID, &e.OldText, &t, &e.EditedBy.ID, &e.EditedBy.Name); err != nil {
+			http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+			return
+		}
+		e.EditedAt = t.Format(time.RFC3339)
+		history = append(history, e)
+	}
+	resp := map[string]any{"id": cid, "text": text, "edited": edited.Valid, "history": history}
+	if edited.Valid {
+		resp["edited_at"] = edited.Time.Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
 }
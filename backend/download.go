@@ -0,0 +1,326 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	minio "github.com/minio/minio-go/v7"
+)
+
+type VideoExport struct {
+	ID          int        `json:"id"`
+	Status      string     `json:"status"`
+	VideosCount int        `json:"videos_count"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// sanitizeDownloadFilename turns a video title into a safe file name with the given extension.
+func sanitizeDownloadFilename(title, ext string) string {
+	var b strings.Builder
+	lastSpace := false
+	for _, r := range strings.TrimSpace(title) {
+		switch {
+		case unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r):
+			r = '_'
+		case unicode.IsSpace(r):
+			if lastSpace {
+				continue
+			}
+			r = ' '
+		}
+		lastSpace = r == ' '
+		b.WriteRune(r)
+	}
+	name := strings.Trim(b.String(), " .")
+	if runes := []rune(name); len(runes) > 100 {
+		name = strings.TrimRight(string(runes[:100]), " .")
+	}
+	if name == "" {
+		name = "video"
+	}
+	ext = strings.ToLower(ext)
+	if ext == "" || len(ext) > 6 || strings.ContainsAny(ext, ` /\"`) {
+		ext = ".mp4"
+	}
+	return name + ext
+}
+
+// contentDisposition builds an attachment header; non-ASCII names are RFC 2231 encoded.
+func contentDisposition(filename string) string {
+	if v := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return `attachment; filename="download"`
+}
+
+// exportPartSize is the multipart chunk of export uploads of unknown size; without it minio-go
+// buffers parts of several hundred megabytes in memory.
+const exportPartSize = 16 << 20
+
+// streamWriteTimeout bounds a single write of a long download; the server-wide WriteTimeout is
+// pushed forward while data keeps flowing, so only stalled clients are cut off.
+const streamWriteTimeout = 60 * time.Second
+
+// copyStreaming copies src to the response, extending the write deadline before each chunk.
+func copyStreaming(w http.ResponseWriter, src io.Reader) (int64, error) {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 256<<10)
+	var n int64
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			// not every ResponseWriter supports deadlines; the copy still works without one
+			_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			nw, werr := w.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// VideoDownloadHandler streams the original uploaded object as an attachment (owner or admin only).
+func VideoDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	role := r.Context().Value(ctxKeyUserRole).(string)
+	var owner int
+	var title, path string
+	if err := db.QueryRow("SELECT user_id, title, video_path FROM videos WHERE id=$1", id).Scan(&owner, &title, &path); err != nil {
+		http.Error(w, "Видео не найдено", http.StatusNotFound)
+		return
+	}
+	if uid != owner && role != "admin" {
+		http.Error(w, "Нет прав", http.StatusForbidden)
+		return
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "videos"
+	}
+	obj, err := minioClient.GetObject(r.Context(), bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		log.Printf("VideoDownloadHandler: GetObject error bucket=%s key=%s: %v", bucket, path, err)
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Content-Disposition", contentDisposition(sanitizeDownloadFilename(title, filepath.Ext(path))))
+	if _, err := copyStreaming(w, obj); err != nil {
+		log.Printf("VideoDownloadHandler: stream error id=%d: %v", id, err)
+	}
+}
+
+// CreateVideoExportHandler starts a background job that zips all originals of the current user.
+func CreateVideoExportHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var busy int
+	// jobs stuck for hours (e.g. after a restart) do not block new exports
+	if err := db.QueryRow(`SELECT 1 FROM video_exports WHERE user_id=$1 AND status IN ('pending','running')
+        AND created_at > NOW() - INTERVAL '6 hours' LIMIT 1`, uid).Scan(&busy); err == nil {
+		http.Error(w, "Экспорт уже выполняется", http.StatusConflict)
+		return
+	}
+	var exp VideoExport
+	if err := db.QueryRow("INSERT INTO video_exports (user_id) VALUES ($1) RETURNING id, status, created_at", uid).Scan(&exp.ID, &exp.Status, &exp.CreatedAt); err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "videos"
+	}
+	go runVideoExport(bucket, exp.ID, uid)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(exp)
+}
+
+// runVideoExport builds the zip and streams it to MinIO without touching local disk.
+func runVideoExport(bucket string, exportID, userID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+	_, _ = db.Exec("UPDATE video_exports SET status='running' WHERE id=$1", exportID)
+	fail := func(err error) {
+		log.Printf("runVideoExport: export=%d user=%d: %v", exportID, userID, err)
+		_, _ = db.Exec("UPDATE video_exports SET status='failed', error=$1, finished_at=NOW() WHERE id=$2", err.Error(), exportID)
+	}
+
+	rows, err := db.Query("SELECT id, title, video_path FROM videos WHERE user_id=$1 ORDER BY created_at ASC", userID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	type item struct {
+		id          int
+		title, path string
+	}
+	items := []item{}
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.title, &it.path); err != nil {
+			rows.Close()
+			fail(err)
+			return
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+
+	key := fmt.Sprintf("exports/%d/%d_%d.zip", userID, exportID, time.Now().Unix())
+	pr, pw := io.Pipe()
+	go func() {
+		zw := zip.NewWriter(pw)
+		for _, it := range items {
+			obj, err := minioClient.GetObject(ctx, bucket, it.path, minio.GetObjectOptions{})
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			// videos are already compressed, store them as-is
+			name := fmt.Sprintf("%d_%s", it.id, sanitizeDownloadFilename(it.title, filepath.Ext(it.path)))
+			fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+			if err == nil {
+				_, err = io.Copy(fw, obj)
+			}
+			obj.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(zw.Close())
+	}()
+	if _, err := minioClient.PutObject(ctx, bucket, key, pr, -1, minio.PutObjectOptions{ContentType: "application/zip", PartSize: exportPartSize}); err != nil {
+		pr.CloseWithError(err)
+		fail(err)
+		return
+	}
+
+	// keep only the latest finished export per user
+	old, err := db.Query("SELECT id, object_key FROM video_exports WHERE user_id=$1 AND status='done' AND id<>$2", userID, exportID)
+	if err == nil {
+		for old.Next() {
+			var oldID int
+			var oldKey sql.NullString
+			if old.Scan(&oldID, &oldKey) == nil {
+				if oldKey.Valid && oldKey.String != "" {
+					_ = minioClient.RemoveObject(ctx, bucket, oldKey.String, minio.RemoveObjectOptions{})
+				}
+				_, _ = db.Exec("DELETE FROM video_exports WHERE id=$1", oldID)
+			}
+		}
+		old.Close()
+	}
+	_, _ = db.Exec("UPDATE video_exports SET status='done', object_key=$1, videos_count=$2, finished_at=NOW() WHERE id=$3", key, len(items), exportID)
+}
+
+// ListVideoExportsHandler lists export jobs of the current user, newest first.
+func ListVideoExportsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	rows, err := db.Query(`SELECT id, status, videos_count, COALESCE(error,''), created_at, finished_at
+        FROM video_exports WHERE user_id=$1 ORDER BY created_at DESC LIMIT 20`, uid)
+	if err != nil {
+		http.Error(w, "Ошибка получения экспортов", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []VideoExport{}
+	for rows.Next() {
+		var e VideoExport
+		var finished sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Status, &e.VideosCount, &e.Error, &e.CreatedAt, &finished); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		if finished.Valid {
+			t := finished.Time
+			e.FinishedAt = &t
+		}
+		if e.Status == "done" {
+			e.DownloadURL = fmt.Sprintf("/api/user/exports/%d/download", e.ID)
+		}
+		out = append(out, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// VideoExportDownloadHandler streams a finished export archive (owner or admin only).
+func VideoExportDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	role := r.Context().Value(ctxKeyUserRole).(string)
+	var owner int
+	var status string
+	var key sql.NullString
+	var created time.Time
+	if err := db.QueryRow("SELECT user_id, status, object_key, created_at FROM video_exports WHERE id=$1", id).Scan(&owner, &status, &key, &created); err != nil {
+		http.Error(w, "Экспорт не найден", http.StatusNotFound)
+		return
+	}
+	if uid != owner && role != "admin" {
+		http.Error(w, "Нет прав", http.StatusForbidden)
+		return
+	}
+	if status != "done" || !key.Valid {
+		http.Error(w, "Экспорт ещё не готов", http.StatusConflict)
+		return
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "videos"
+	}
+	obj, err := minioClient.GetObject(r.Context(), bucket, key.String, minio.GetObjectOptions{})
+	if err != nil {
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		http.Error(w, "Файл не найден", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Content-Disposition", contentDisposition(fmt.Sprintf("reelsup_export_%s.zip", created.Format("2006-01-02"))))
+	if _, err := copyStreaming(w, obj); err != nil {
+		log.Printf("VideoExportDownloadHandler: stream error id=%d: %v", id, err)
+	}
+}
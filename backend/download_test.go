@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeDownloadFilename(t *testing.T) {
+	cases := map[string]string{
+		"Кроссовки  Nike: обзор?": "Кроссовки Nike_ обзор_.mp4",
+		"../../etc/passwd":        "_.._etc_passwd.mp4",
+		"   ":                     "video.mp4",
+	}
+	for in, want := range cases {
+		if got := sanitizeDownloadFilename(in, ".MP4"); got != want {
+			t.Fatalf("sanitizeDownloadFilename(%q)=%q, want %q", in, got, want)
+		}
+	}
+	if got := sanitizeDownloadFilename(strings.Repeat("я", 300), ".mov"); len([]rune(got)) != 104 {
+		t.Fatalf("long title should be truncated, got %d runes", len([]rune(got)))
+	}
+}
+
+func TestContentDispositionEncodesUnicode(t *testing.T) {
+	v := contentDisposition("Обзор.mp4")
+	if !strings.HasPrefix(v, "attachment;") || !strings.Contains(v, "filename*=") {
+		t.Fatalf("unexpected header %q", v)
+	}
+}
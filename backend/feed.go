@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Every forYouExploreEvery-th item of the personalized feed is an exploration pick
+// from outside the user's known interests.
+const forYouExploreEvery = 5
+
+// forYouScoredCTE scores approved, not yet interacted-with videos of other creators for user $1.
+// Interactions: like +3, dislike -4, rating (value-4), comment +1, watched (+1 past 80%, +0.25
+// otherwise; opened videos also count as seen). They are aggregated into
+// affinities per category, tag and creator; trending_score breaks ties between unknown items.
+const forYouScoredCTE = `
+WITH interactions AS (
+    SELECT video_id, 3.0::float8 AS w FROM likes WHERE user_id = $1
+    UNION ALL SELECT video_id, -4.0 FROM dislikes WHERE user_id = $1
+    UNION ALL SELECT video_id, (value - 4)::float8 FROM ratings WHERE user_id = $1
+    UNION ALL SELECT video_id, 1.0 FROM comments WHERE user_id = $1
+    UNION ALL SELECT video_id, CASE WHEN percent >= 80 THEN 1.0 ELSE 0.25 END FROM watch_history WHERE user_id = $1
+),
+cat_aff AS (
+    SELECT iv.category_id AS id, SUM(i.w) AS w
+    FROM interactions i JOIN videos iv ON iv.id = i.video_id
+    WHERE iv.category_id IS NOT NULL GROUP BY iv.category_id
+),
+tag_aff AS (
+    SELECT vt.tag_id AS id, SUM(i.w) AS w
+    FROM interactions i JOIN video_tags vt ON vt.video_id = i.video_id GROUP BY vt.tag_id
+),
+creator_aff AS (
+    SELECT iv.user_id AS id, SUM(i.w) AS w
+    FROM interactions i JOIN videos iv ON iv.id = i.video_id GROUP BY iv.user_id
+),
+scored AS (
+    SELECT s.id,
+        COALESCE((SELECT w FROM cat_aff WHERE id = s.category_id), 0)
+        + 0.5 * COALESCE((SELECT SUM(ta.w) FROM video_tags vt JOIN tag_aff ta ON ta.id = vt.tag_id WHERE vt.video_id = s.id), 0)
+        + 1.5 * COALESCE((SELECT w FROM creator_aff WHERE id = s.user_id), 0) AS affinity
+    FROM videos s
+    WHERE s.is_approved = TRUE AND s.user_id <> $1
+      AND NOT EXISTS (SELECT 1 FROM interactions i WHERE i.video_id = s.id)
+)`
+
+// ForYouFeedHandler returns a personalized feed for logged-in users and trending for anonymous ones.
+// Personalized picks (positive affinity) are interleaved with exploration picks (trending items
+// outside the user's interests). The two pools are disjoint within one request, but the ranking is
+// recomputed per page from current affinities and scores, so later pages may repeat or skip items
+// after the user interacts with the feed; the offset cursor does not freeze it.
+func ForYouFeedHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(ctxKeyUserID).(int)
+	var hasHistory bool
+	if ok {
+		_ = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM likes WHERE user_id=$1)
+            OR EXISTS (SELECT 1 FROM ratings WHERE user_id=$1)
+            OR EXISTS (SELECT 1 FROM dislikes WHERE user_id=$1)
+            OR EXISTS (SELECT 1 FROM comments WHERE user_id=$1)
+            OR EXISTS (SELECT 1 FROM watch_history WHERE user_id=$1)`, uid).Scan(&hasHistory)
+	}
+	if !ok || !hasHistory {
+		// Anonymous or cold-start user: fall back to the trending listing
+		q := r.URL.Query()
+		q.Set("sort", "trending")
+		r.URL.RawQuery = q.Encode()
+		ListVideosHandler(w, r)
+		return
+	}
+
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	offsets, err := decodeOffsetCursor(r.URL.Query().Get("cursor"), "for-you", 2)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	exploreWant := limit / forYouExploreEvery
+	personal, err := queryForYou(uid, true, limit-exploreWant, offsets[0])
+	if err != nil {
+		log.Printf("ForYouFeedHandler: personal query error user=%d: %v", uid, err)
+		http.Error(w, "Ошибка получения ленты", http.StatusInternalServerError)
+		return
+	}
+	// when personal picks run out, exploration fills the rest of the page
+	explore, err := queryForYou(uid, false, limit-len(personal), offsets[1])
+	if err != nil {
+		log.Printf("ForYouFeedHandler: explore query error user=%d: %v", uid, err)
+		http.Error(w, "Ошибка получения ленты", http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]Video, 0, len(personal)+len(explore))
+	pi, ei := 0, 0
+	for pi < len(personal) || ei < len(explore) {
+		if ei < len(explore) && (pi >= len(personal) || (len(out)+1)%forYouExploreEvery == 0) {
+			out = append(out, explore[ei])
+			ei++
+		} else {
+			out = append(out, personal[pi])
+			pi++
+		}
+	}
+	next := ""
+	if len(personal) == limit-exploreWant || len(explore) == limit-len(personal) {
+		next = encodeOffsetCursor("for-you", offsets[0]+len(personal), offsets[1]+len(explore))
+	}
+	writeVideoPage(w, out, next, pageParams{Limit: limit})
+}
+
+// queryForYou reads one pool of the personalized feed: affinity > 0 ranked by affinity,
+// or the exploration pool (affinity <= 0) ranked by trending score.
+func queryForYou(uid int, personal bool, limit, offset int) ([]Video, error) {
+	out := []Video{}
+	if limit <= 0 {
+		return out, nil
+	}
+	cond := "sc.affinity > 0"
+	order := "sc.affinity DESC, COALESCE(vs.score, 0) DESC, v.created_at DESC, v.id DESC"
+	if !personal {
+		cond = "sc.affinity <= 0"
+		order = "COALESCE(vs.score, 0) DESC, v.created_at DESC, v.id DESC"
+	}
+	rows, err := db.Query(forYouScoredCTE+`
+        SELECT `+videoListColumns+`
+        FROM scored sc
+        JOIN videos v ON v.id = sc.id
+        `+videoListJoins+`
+        WHERE `+cond+`
+        ORDER BY `+order+`
+        LIMIT `+strconv.Itoa(limit)+` OFFSET `+strconv.Itoa(offset), uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v Video
+		if err := scanVideo(rows, &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
+)
+
+// CreatorProfile is the public card of a user with follow counters.
+type CreatorProfile struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Handle         string `json:"handle"`
+	AvatarURL      string `json:"avatar_url"`
+	VideosCount    int    `json:"videos_count"`
+	FollowersCount int    `json:"followers_count"`
+	FollowingCount int    `json:"following_count"`
+	FollowedByMe   bool   `json:"followed_by_me"`
+}
+
+// CreatorProfileHandler returns the public profile of a user; followed_by_me needs a token.
+func CreatorProfileHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var p CreatorProfile
+	var avatarPath sql.NullString
+	err := db.QueryRow(`SELECT u.id, COALESCE(u.name,''), COALESCE(u.handle,''), u.avatar_path,
+            (SELECT COUNT(*) FROM videos v WHERE v.user_id = u.id AND v.is_approved = TRUE),
+            (SELECT COUNT(*) FROM follows f WHERE f.followee_id = u.id),
+            (SELECT COUNT(*) FROM follows f WHERE f.follower_id = u.id)
+        FROM users u WHERE u.id=$1`, id).Scan(&p.ID, &p.Name, &p.Handle, &avatarPath, &p.VideosCount, &p.FollowersCount, &p.FollowingCount)
+	if err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+	p.AvatarURL = buildAvatarURL(p.ID, avatarPath)
+	if uid, ok := r.Context().Value(ctxKeyUserID).(int); ok {
+		_ = db.QueryRow("SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id=$1 AND followee_id=$2)", uid, id).Scan(&p.FollowedByMe)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// FollowUserHandler subscribes the current user to a creator (idempotent).
+func FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	if id == uid {
+		http.Error(w, "Нельзя подписаться на себя", http.StatusBadRequest)
+		return
+	}
+	var blocked bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_blocks
+        WHERE (blocker_id=$1 AND blocked_id=$2) OR (blocker_id=$2 AND blocked_id=$1))`, uid, id).Scan(&blocked); err != nil {
+		http.Error(w, "Ошибка подписки", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "Подписка недоступна", http.StatusForbidden)
+		return
+	}
+	if _, err := db.Exec("INSERT INTO follows (follower_id, followee_id) VALUES ($1,$2) ON CONFLICT DO NOTHING", uid, id); err != nil {
+		if pe, ok := err.(*pq.Error); ok && pe.Code.Name() == "foreign_key_violation" {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Ошибка подписки", http.StatusInternalServerError)
+		return
+	}
+	writeFollowState(w, uid, id, true)
+}
+
+// UnfollowUserHandler removes the subscription (idempotent).
+func UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	if _, err := db.Exec("DELETE FROM follows WHERE follower_id=$1 AND followee_id=$2", uid, id); err != nil {
+		http.Error(w, "Ошибка отписки", http.StatusInternalServerError)
+		return
+	}
+	writeFollowState(w, uid, id, false)
+}
+
+func writeFollowState(w http.ResponseWriter, uid, id int, following bool) {
+	var followers int
+	_ = db.QueryRow("SELECT COUNT(*) FROM follows WHERE followee_id=$1", id).Scan(&followers)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"user_id": id, "following": following, "followers_count": followers})
+}
+
+// BlockUserHandler blocks a user (idempotent): follows in both directions are dropped and the
+// pair can no longer mention each other.
+func BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	if id == uid {
+		http.Error(w, "Нельзя заблокировать себя", http.StatusBadRequest)
+		return
+	}
+	if _, err := db.Exec("INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1,$2) ON CONFLICT DO NOTHING", uid, id); err != nil {
+		if pe, ok := err.(*pq.Error); ok && pe.Code.Name() == "foreign_key_violation" {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Ошибка блокировки", http.StatusInternalServerError)
+		return
+	}
+	if _, err := db.Exec("DELETE FROM follows WHERE (follower_id=$1 AND followee_id=$2) OR (follower_id=$2 AND followee_id=$1)", uid, id); err != nil {
+		log.Printf("BlockUserHandler: drop follows %d<->%d: %v", uid, id, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"user_id": id, "blocked": true})
+}
+
+// UnblockUserHandler lifts a block (idempotent).
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	if _, err := db.Exec("DELETE FROM user_blocks WHERE blocker_id=$1 AND blocked_id=$2", uid, id); err != nil {
+		http.Error(w, "Ошибка разблокировки", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"user_id": id, "blocked": false})
+}
+
+// ListFollowingHandler lists whom the current user follows, most recent first (offset cursor).
+func ListFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	offsets, err := decodeOffsetCursor(r.URL.Query().Get("cursor"), "following", 1)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	rows, err := db.Query(`SELECT u.id, COALESCE(u.name,''), COALESCE(u.handle,''), u.avatar_path,
+            (SELECT COUNT(*) FROM videos v WHERE v.user_id = u.id AND v.is_approved = TRUE),
+            (SELECT COUNT(*) FROM follows x WHERE x.followee_id = u.id),
+            (SELECT COUNT(*) FROM follows x WHERE x.follower_id = u.id)
+        FROM follows f JOIN users u ON u.id = f.followee_id
+        WHERE f.follower_id = $1
+        ORDER BY f.created_at DESC, u.id DESC
+        LIMIT `+strconv.Itoa(limit+1)+` OFFSET `+strconv.Itoa(offsets[0]), uid)
+	if err != nil {
+		http.Error(w, "Ошибка получения подписок", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []CreatorProfile{}
+	for rows.Next() {
+		var p CreatorProfile
+		var avatarPath sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &avatarPath, &p.VideosCount, &p.FollowersCount, &p.FollowingCount); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		p.AvatarURL = buildAvatarURL(p.ID, avatarPath)
+		p.FollowedByMe = true
+		out = append(out, p)
+	}
+	next := ""
+	if len(out) > limit {
+		out = out[:limit]
+		next = encodeOffsetCursor("following", offsets[0]+limit)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": out, "next_cursor": next})
+}
+
+// SubscriptionItem is either a video or a live stream of a followed creator.
+type SubscriptionItem struct {
+	Type       string      `json:"type"` // video or live
+	At         time.Time   `json:"at"`
+	Video      *Video      `json:"video,omitempty"`
+	LiveStream *LiveStream `json:"live_stream,omitempty"`
+}
+
+// SubscriptionsFeedHandler returns approved videos of followed creators, newest first, with keyset
+// pagination. The first page also merges in their currently live streams by start time.
+func SubscriptionsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	order := videoSorts["new"]
+	page, err := parsePageParams(r, order)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	page.Legacy = false
+	query, params := paginateQuery(`SELECT `+videoListColumns+`
+        FROM videos v `+videoListJoins+`
+        WHERE v.is_approved = TRUE
+          AND v.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)`, []any{uid}, order, page)
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		log.Printf("SubscriptionsFeedHandler: query error user=%d: %v", uid, err)
+		http.Error(w, "Ошибка получения ленты", http.StatusInternalServerError)
+		return
+	}
+	videos := []Video{}
+	for rows.Next() {
+		var v Video
+		if err := scanVideo(rows, &v); err != nil {
+			rows.Close()
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		videos = append(videos, v)
+	}
+	rows.Close()
+	videos, next := trimPage(videos, order, page)
+
+	items := make([]SubscriptionItem, 0, len(videos))
+	for i := range videos {
+		items = append(items, SubscriptionItem{Type: "video", At: videos[i].CreatedAt, Video: &videos[i]})
+	}
+	if page.Cursor == nil {
+		lrows, err := db.Query(`SELECT l.id, l.title, l.description, l.stream_url, l.thumbnail_url, l.status,
+                l.scheduled_at, l.started_at, l.ended_at, l.created_at, l.user_id, COALESCE(u.name,'')
+            FROM live_streams l
+            JOIN users u ON u.id = l.user_id
+            WHERE l.status = 'live'
+              AND l.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)
+            ORDER BY COALESCE(l.started_at, l.created_at) DESC
+            LIMIT 20`, uid)
+		if err == nil {
+			var streams []LiveStream
+			streams, err = scanLiveStreams(lrows)
+			for i := range streams {
+				at := streams[i].CreatedAt
+				if streams[i].StartedAt != nil {
+					at = *streams[i].StartedAt
+				}
+				items = append(items, SubscriptionItem{Type: "live", At: at, LiveStream: &streams[i]})
+			}
+		}
+		if err != nil {
+			log.Printf("SubscriptionsFeedHandler: live streams error user=%d: %v", uid, err)
+		}
+		sort.SliceStable(items, func(i, j int) bool { return items[i].At.After(items[j].At) })
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": items, "next_cursor": next})
+}
@@ -8,6 +8,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/minio/minio-go/v7 v7.0.70
 	golang.org/x/crypto v0.28.0
+	golang.org/x/image v0.18.0
 )
 
 require (
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// watchCompletePercent is the progress after which a video counts as watched to the end;
+// such videos are not offered for resuming.
+const watchCompletePercent = 95.0
+
+// HistoryItem is one watched video with the viewer's progress.
+type HistoryItem struct {
+	Video     Video     `json:"video"`
+	Position  float64   `json:"position"`
+	Percent   float64   `json:"percent"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+// RecordWatchProgressHandler stores the player's position for the current user.
+// Body: { position: seconds, percent?: 0-100 }; percent is derived from the video duration
+// when omitted. Nothing is stored while the user's history is paused.
+func RecordWatchProgressHandler(w http.ResponseWriter, r *http.Request) {
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var req struct {
+		Position float64  `json:"position"`
+		Percent  *float64 `json:"percent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Position < 0 {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	var paused, approved bool
+	var duration float64
+	err := db.QueryRow(`SELECT u.history_paused, v.is_approved, COALESCE(v.duration_seconds, 0)
+        FROM users u, videos v WHERE u.id=$1 AND v.id=$2`, uid, vid).Scan(&paused, &approved, &duration)
+	if err != nil || !approved {
+		http.Error(w, "Видео не найдено", http.StatusNotFound)
+		return
+	}
+	if paused {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"recorded": false, "paused": true})
+		return
+	}
+	percent := 0.0
+	if req.Percent != nil {
+		percent = *req.Percent
+	} else if duration > 0 {
+		percent = req.Position / duration * 100
+	}
+	if duration > 0 && req.Position > duration {
+		req.Position = duration
+	}
+	percent = math.Max(0, math.Min(100, percent))
+	if _, err := db.Exec(`INSERT INTO watch_history (user_id, video_id, position_seconds, percent)
+        VALUES ($1,$2,$3,$4)
+        ON CONFLICT (user_id, video_id) DO UPDATE SET position_seconds=EXCLUDED.position_seconds,
+            percent=EXCLUDED.percent, watched_at=NOW()`, uid, vid, req.Position, percent); err != nil {
+		log.Printf("RecordWatchProgressHandler: upsert error user=%d video=%d: %v", uid, vid, err)
+		http.Error(w, "Ошибка сохранения", http.StatusInternalServerError)
+		return
+	}
+	if percent >= watchCompletePercent {
+		// finished: no longer "to watch later"
+		_, _ = db.Exec("DELETE FROM video_bookmarks WHERE user_id=$1 AND video_id=$2 AND list=$3", uid, vid, listWatchLater)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"recorded": true, "position": req.Position, "percent": percent})
+}
+
+// resumePosition returns where the user stopped watching a video, if it was not finished.
+func resumePosition(uid, vid int) *float64 {
+	var pos float64
+	err := db.QueryRow(`SELECT position_seconds FROM watch_history
+        WHERE user_id=$1 AND video_id=$2 AND percent < $3 AND position_seconds > 0`, uid, vid, watchCompletePercent).Scan(&pos)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("resumePosition: user=%d video=%d: %v", uid, vid, err)
+		}
+		return nil
+	}
+	return &pos
+}
+
+// ListWatchHistoryHandler returns the user's history, most recently watched first (offset cursor).
+func ListWatchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	offsets, err := decodeOffsetCursor(r.URL.Query().Get("cursor"), "history", 1)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	rows, err := db.Query(`SELECT `+videoListColumns+`, h.position_seconds, h.percent, h.watched_at
+        FROM watch_history h
+        JOIN videos v ON v.id = h.video_id
+        `+videoListJoins+`
+        WHERE h.user_id = $1 AND v.is_approved = TRUE
+        ORDER BY h.watched_at DESC, v.id DESC
+        LIMIT `+strconv.Itoa(limit+1)+` OFFSET `+strconv.Itoa(offsets[0]), uid)
+	if err != nil {
+		log.Printf("ListWatchHistoryHandler: query error user=%d: %v", uid, err)
+		http.Error(w, "Ошибка получения истории", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []HistoryItem{}
+	for rows.Next() {
+		var it HistoryItem
+		if err := scanVideo(rows, &it.Video, &it.Position, &it.Percent, &it.WatchedAt); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	next := ""
+	if len(out) > limit {
+		out = out[:limit]
+		next = encodeOffsetCursor("history", offsets[0]+limit)
+	}
+	var paused bool
+	_ = db.QueryRow("SELECT history_paused FROM users WHERE id=$1", uid).Scan(&paused)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": out, "next_cursor": next, "paused": paused})
+}
+
+// PauseWatchHistoryHandler turns history recording off or back on. Body: { paused: bool }
+func PauseWatchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var req struct {
+		Paused bool `json:"paused"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	if _, err := db.Exec("UPDATE users SET history_paused=$1 WHERE id=$2", req.Paused, uid); err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"paused": req.Paused})
+}
+
+// ClearWatchHistoryHandler removes the whole history, or one video when {videoId} is given.
+func ClearWatchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var err error
+	if v, ok := mux.Vars(r)["videoId"]; ok {
+		vid, _ := strconv.Atoi(v)
+		_, err = db.Exec("DELETE FROM watch_history WHERE user_id=$1 AND video_id=$2", uid, vid)
+	} else {
+		_, err = db.Exec("DELETE FROM watch_history WHERE user_id=$1", uid)
+	}
+	if err != nil {
+		http.Error(w, "Ошибка очистки истории", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
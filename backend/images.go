@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	_ "image/gif"
+
+	"github.com/gorilla/mux"
+	minio "github.com/minio/minio-go/v7"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Allowed derivative dimensions. 0 means "derive from the other side keeping aspect ratio".
+var imageWidthAllowlist = map[int]bool{0: true, 48: true, 96: true, 128: true, 160: true, 240: true, 256: true, 320: true, 480: true, 640: true, 960: true}
+var imageHeightAllowlist = map[int]bool{0: true, 48: true, 96: true, 128: true, 135: true, 180: true, 256: true, 270: true, 360: true, 540: true}
+
+var imageFormatContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+}
+
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// parseImageParams validates w/h/format query params against the allowlists.
+func parseImageParams(wStr, hStr, format string) (int, int, string, error) {
+	width, height := 0, 0
+	var err error
+	if wStr != "" {
+		if width, err = strconv.Atoi(wStr); err != nil || !imageWidthAllowlist[width] {
+			return 0, 0, "", fmt.Errorf("width not allowed")
+		}
+	}
+	if hStr != "" {
+		if height, err = strconv.Atoi(hStr); err != nil || !imageHeightAllowlist[height] {
+			return 0, 0, "", fmt.Errorf("height not allowed")
+		}
+	}
+	if width == 0 && height == 0 {
+		return 0, 0, "", fmt.Errorf("width or height required")
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" || format == "jpg" {
+		format = "jpeg"
+	}
+	if _, ok := imageFormatContentTypes[format]; !ok {
+		return 0, 0, "", fmt.Errorf("format not allowed")
+	}
+	return width, height, format, nil
+}
+
+// derivedImageKey builds a deterministic MinIO key for a resized derivative.
+// The source key is hashed in so a replaced source never serves a stale derivative.
+func derivedImageKey(kind string, id int, sourceKey string, width, height int, format string) string {
+	sum := sha1.Sum([]byte(sourceKey))
+	return fmt.Sprintf("derived/%s/%d/%s_%dx%d.%s", kind, id, hex.EncodeToString(sum[:])[:12], width, height, format)
+}
+
+// resizeImage scales src to the requested box. When both sides are set the image is
+// center-cropped to the target aspect ratio first; when one side is 0 it is derived.
+func resizeImage(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 {
+		return src
+	}
+	if width == 0 {
+		width = sw * height / sh
+	}
+	if height == 0 {
+		height = sh * width / sw
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	crop := b
+	if sw*height != sh*width {
+		if sw*height > sh*width {
+			// source wider than target: trim left/right
+			cw := sh * width / height
+			x0 := b.Min.X + (sw-cw)/2
+			crop = image.Rect(x0, b.Min.Y, x0+cw, b.Max.Y)
+		} else {
+			ch := sw * height / width
+			y0 := b.Min.Y + (sh-ch)/2
+			crop = image.Rect(b.Min.X, y0, b.Max.X, y0+ch)
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+	return dst
+}
+
+// encodeImage writes img in the requested format. WebP goes through ffmpeg since the
+// standard library has no WebP encoder.
+func encodeImage(ctx context.Context, img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "webp":
+		var in bytes.Buffer
+		if err := png.Encode(&in, img); err != nil {
+			return nil, err
+		}
+		cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-loglevel", "error",
+			"-f", "png_pipe", "-i", "pipe:0", "-c:v", "libwebp", "-quality", "80", "-f", "webp", "pipe:1")
+		cmd.Stdin = &in
+		cmd.Stdout = &buf
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("ffmpeg webp encode failed: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// imageSourceKey resolves the MinIO key of the original image for a kind/id pair.
+// A non-empty second result is a public asset path the client should be redirected to.
+func imageSourceKey(kind string, id int) (string, string, error) {
+	switch kind {
+	case "thumbnail":
+		var thumb string
+		var approved bool
+		if err := db.QueryRow("SELECT COALESCE(thumbnail_path,''), is_approved FROM videos WHERE id=$1", id).Scan(&thumb, &approved); err != nil {
+			return "", "", err
+		}
+		if thumb == "" || !approved {
+			return "", "", fmt.Errorf("no thumbnail")
+		}
+		return thumb + ".jpg", "", nil
+	case "avatar":
+		var avatar string
+		if err := db.QueryRow("SELECT COALESCE(avatar_path,'') FROM users WHERE id=$1", id).Scan(&avatar); err != nil {
+			return "", "", err
+		}
+		if strings.TrimSpace(avatar) == "" {
+			return "", "", fmt.Errorf("no avatar")
+		}
+		if strings.HasPrefix(avatar, "/") {
+			return "", avatar, nil
+		}
+		return avatar, "", nil
+	}
+	return "", "", fmt.Errorf("unknown kind %q", kind)
+}
+
+// ImageHandler serves resized thumbnails and avatars, caching derivatives in MinIO.
+// GET /api/images/{kind}/{id}?w=320&h=180&format=webp
+func ImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kind := vars["kind"]
+	id, _ := strconv.Atoi(vars["id"])
+	q := r.URL.Query()
+	width, height, format, err := parseImageParams(q.Get("w"), q.Get("h"), q.Get("format"))
+	if err != nil {
+		http.Error(w, "Недопустимые параметры изображения", http.StatusBadRequest)
+		return
+	}
+	srcKey, redirect, err := imageSourceKey(kind, id)
+	if err != nil {
+		http.Error(w, "Изображение не найдено", http.StatusNotFound)
+		return
+	}
+	if redirect != "" {
+		http.Redirect(w, r, redirect, http.StatusTemporaryRedirect)
+		return
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "videos"
+	}
+	key := derivedImageKey(kind, id, srcKey, width, height, format)
+	etag := `"` + key + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Serve cached derivative when present
+	if info, err := minioClient.StatObject(r.Context(), bucket, key, minio.StatObjectOptions{}); err == nil {
+		obj, err := minioClient.GetObject(r.Context(), bucket, key, minio.GetObjectOptions{})
+		if err == nil {
+			defer obj.Close()
+			w.Header().Set("Content-Type", imageFormatContentTypes[format])
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+			w.Header().Set("Cache-Control", imageCacheControl)
+			w.Header().Set("ETag", etag)
+			_, _ = io.Copy(w, obj)
+			return
+		}
+	}
+
+	obj, err := minioClient.GetObject(r.Context(), bucket, srcKey, minio.GetObjectOptions{})
+	if err != nil {
+		http.Error(w, "Изображение не найдено", http.StatusNotFound)
+		return
+	}
+	defer obj.Close()
+	src, _, err := image.Decode(obj)
+	if err != nil {
+		log.Printf("ImageHandler: decode error key=%s: %v", srcKey, err)
+		http.Error(w, "Изображение не найдено", http.StatusNotFound)
+		return
+	}
+	data, err := encodeImage(r.Context(), resizeImage(src, width, height), format)
+	if err != nil {
+		log.Printf("ImageHandler: encode error key=%s: %v", key, err)
+		http.Error(w, "Ошибка обработки изображения", http.StatusInternalServerError)
+		return
+	}
+	if _, err := minioClient.PutObject(r.Context(), bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  imageFormatContentTypes[format],
+		CacheControl: imageCacheControl,
+	}); err != nil {
+		log.Printf("ImageHandler: cache PutObject error key=%s: %v", key, err)
+	}
+	w.Header().Set("Content-Type", imageFormatContentTypes[format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", imageCacheControl)
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write(data)
+}
+
+// removeDerivedImages deletes all cached derivatives of a kind/id pair (best-effort).
+func removeDerivedImages(ctx context.Context, bucket, kind string, id int) {
+	prefix := fmt.Sprintf("derived/%s/%d/", kind, id)
+	for obj := range minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			log.Printf("removeDerivedImages: list error prefix=%s: %v", prefix, obj.Err)
+			return
+		}
+		if err := minioClient.RemoveObject(ctx, bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("removeDerivedImages: remove error key=%s: %v", obj.Key, err)
+		}
+	}
+}
+
+// jpegOrientation extracts the EXIF orientation tag (1..8) from JPEG data; 1 when absent.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(data[i+2])<<8 | int(data[i+3])
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation reads tag 0x0112 from IFD0 of a TIFF header.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var u16 func([]byte) int
+	var u32 func([]byte) int
+	switch string(tiff[:2]) {
+	case "II":
+		u16 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 }
+		u32 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24 }
+	case "MM":
+		u16 = func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+		u32 = func(b []byte) int { return int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3]) }
+	default:
+		return 1
+	}
+	off := u32(tiff[4:8])
+	if off < 8 || off+2 > len(tiff) {
+		return 1
+	}
+	n := u16(tiff[off : off+2])
+	for k := 0; k < n; k++ {
+		e := off + 2 + k*12
+		if e+12 > len(tiff) {
+			return 1
+		}
+		if u16(tiff[e:e+2]) == 0x0112 {
+			if o := u16(tiff[e+8 : e+10]); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation returns img transformed so that it displays upright for the given EXIF orientation.
+// The source is converted to RGBA once (draw has fast paths for decoded JPEGs) and pixels are then
+// moved as 4-byte words over the Pix slices.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src, ok := img.(*image.RGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+	}
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 CW
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 270 CW
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], row[x*4:x*4+4])
+		}
+	}
+	return dst
+}
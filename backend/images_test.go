@@ -0,0 +1,83 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseImageParams(t *testing.T) {
+	w, h, f, err := parseImageParams("320", "180", "")
+	if err != nil || w != 320 || h != 180 || f != "jpeg" {
+		t.Fatalf("unexpected result: %d %d %s %v", w, h, f, err)
+	}
+	if _, _, _, err := parseImageParams("333", "", "jpeg"); err == nil {
+		t.Fatalf("width outside allowlist should be rejected")
+	}
+	if _, _, _, err := parseImageParams("320", "", "png"); err == nil {
+		t.Fatalf("png should be rejected")
+	}
+	if _, _, _, err := parseImageParams("", "", "webp"); err == nil {
+		t.Fatalf("missing dimensions should be rejected")
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1920, 1080))
+	if b := resizeImage(src, 320, 0).Bounds(); b.Dx() != 320 || b.Dy() != 180 {
+		t.Fatalf("aspect-preserving resize got %v", b)
+	}
+	if b := resizeImage(src, 96, 96).Bounds(); b.Dx() != 96 || b.Dy() != 96 {
+		t.Fatalf("cropped resize got %v", b)
+	}
+}
+
+func TestDerivedImageKeyDeterministic(t *testing.T) {
+	a := derivedImageKey("avatar", 7, "avatars/7_1.png", 96, 96, "webp")
+	b := derivedImageKey("avatar", 7, "avatars/7_1.png", 96, 96, "webp")
+	c := derivedImageKey("avatar", 7, "avatars/7_2.png", 96, 96, "webp")
+	if a != b {
+		t.Fatalf("keys should be deterministic: %s != %s", a, b)
+	}
+	if a == c {
+		t.Fatalf("different sources should produce different keys")
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0, 0, 0, 0, 0}
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	size := len(seg) + 2
+	data := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, byte(size >> 8), byte(size)}, seg...)
+	data = append(data, 0xFF, 0xDA, 0, 2)
+	if o := jpegOrientation(data); o != 6 {
+		t.Fatalf("expected orientation 6, got %d", o)
+	}
+	if o := jpegOrientation([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0, 2}); o != 1 {
+		t.Fatalf("expected default orientation 1, got %d", o)
+	}
+}
+
+func TestApplyOrientationRotates(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+	rot := applyOrientation(src, 6)
+	if b := rot.Bounds(); b.Dx() != 30 || b.Dy() != 40 {
+		t.Fatalf("rotate 90 got %v", b)
+	}
+	if r, _, _, _ := rot.At(29, 0).RGBA(); r != 0xFFFF {
+		t.Fatalf("top-left pixel should move to the top-right corner")
+	}
+	if b := applyOrientation(src, 3).Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Fatalf("rotate 180 got %v", b)
+	}
+}
+
+func TestPickAvatarSize(t *testing.T) {
+	cases := map[int]int{1: 64, 64: 64, 100: 128, 256: 256, 300: 512, 4000: 512}
+	for req, want := range cases {
+		if got := pickAvatarSize(req); got != want {
+			t.Fatalf("pickAvatarSize(%d)=%d, want %d", req, got, want)
+		}
+	}
+}
@@ -51,6 +51,7 @@ func seedAdmin() {
 			log.Println("seedAdmin: create admin error:", err)
 			return
 		}
+		assignDefaultHandle(id)
 		log.Println("seedAdmin: admin user created:", adminEmail)
 		return
 	} else if err != nil {
@@ -176,6 +177,10 @@ func main() {
 	log.Println("seedAdmin: env check -> ADMIN_EMAIL=", adminEmailLog, " ADMIN_PASSWORD set? ", adminPwdSet)
 	// Ensure initial admin exists / updated per env
 	seedAdmin()
+	// periodic trending score refresh for sort=trending
+	go startTrendingRecalculator()
+	go startReelImpressionsPruner()
+	go startSearchLogPruner()
 
 	// MinIO
 	minioEndpoint := os.Getenv("MINIO_ENDPOINT")
@@ -195,6 +200,8 @@ func main() {
 		log.Fatalf("MinIO init timeout: %v", err)
 	}
 	log.Println("Connected to MinIO, bucket:", bucket)
+	// probes stored objects, so only once MinIO is up
+	go backfillVideoDurations()
 
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api").Subrouter()
@@ -202,15 +209,34 @@ func main() {
 	api.HandleFunc("/login", LoginHandler).Methods("POST")
 	// Public avatar content for MinIO-stored avatars
 	api.HandleFunc("/users/{id:[0-9]+}/avatar", UserAvatarContentHandler).Methods("GET")
-	api.HandleFunc("/videos", ListVideosHandler).Methods("GET")
+	api.Handle("/users/{id:[0-9]+}", JWTOptionalMiddleware(http.HandlerFunc(CreatorProfileHandler))).Methods("GET")
+	api.HandleFunc("/users/{id:[0-9]+}/playlists", ListUserPlaylistsHandler).Methods("GET")
+	api.Handle("/playlists/{key:[A-Za-z0-9_-]+}", JWTOptionalMiddleware(http.HandlerFunc(GetPlaylistHandler))).Methods("GET")
+	api.Handle("/videos", JWTOptionalMiddleware(http.HandlerFunc(ListVideosHandler))).Methods("GET")
 	api.Handle("/videos/{id:[0-9]+}", JWTOptionalMiddleware(http.HandlerFunc(GetVideoHandler))).Methods("GET")
 	api.Handle("/videos/{id:[0-9]+}/content", JWTOptionalMiddleware(http.HandlerFunc(VideoContentHandler))).Methods("GET")
 	api.HandleFunc("/videos/{id:[0-9]+}/thumbnail", VideoThumbnailStaticHandler).Methods("GET")
 	api.HandleFunc("/videos/{id:[0-9]+}/thumbnail/animated", VideoThumbnailAnimatedHandler).Methods("GET")
-	api.HandleFunc("/videos/{id:[0-9]+}/comments", ListCommentsHandler).Methods("GET")
+	// Resized thumbnails/avatars, e.g. /api/images/thumbnail/1?w=320&h=180&format=webp
+	api.HandleFunc("/images/{kind:thumbnail|avatar}/{id:[0-9]+}", ImageHandler).Methods("GET")
+	api.Handle("/videos/{id:[0-9]+}/comments", JWTOptionalMiddleware(http.HandlerFunc(ListCommentsHandler))).Methods("GET")
+	api.Handle("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}/replies", JWTOptionalMiddleware(http.HandlerFunc(ListCommentRepliesHandler))).Methods("GET")
+	api.HandleFunc("/videos/{id:[0-9]+}/related", RelatedVideosHandler).Methods("GET")
 	api.HandleFunc("/categories", CategoriesHandler).Methods("GET")
+	api.HandleFunc("/categories/tree", CategoryTreeHandler).Methods("GET")
+	api.HandleFunc("/categories/{id:[0-9]+}/breadcrumbs", CategoryBreadcrumbsHandler).Methods("GET")
+	api.Handle("/feed/for-you", JWTOptionalMiddleware(http.HandlerFunc(ForYouFeedHandler))).Methods("GET")
+	api.Handle("/reels/feed", JWTOptionalMiddleware(http.HandlerFunc(ReelsFeedHandler))).Methods("GET")
+	// normalized tags: usage counts, autocomplete and tag pages
+	api.HandleFunc("/search/suggest", SearchSuggestHandler).Methods("GET")
+	api.HandleFunc("/tags", ListTagsHandler).Methods("GET")
+	api.HandleFunc("/tags/suggest", SuggestTagsHandler).Methods("GET")
+	api.HandleFunc("/tags/{tag}", TagVideosHandler).Methods("GET")
 	api.HandleFunc("/livestreams", ListLiveStreamsHandler).Methods("GET")
 	api.HandleFunc("/livestreams/{id:[0-9]+}", GetLiveStreamHandler).Methods("GET")
+	api.Handle("/videos/{id:[0-9]+}/share", JWTOptionalMiddleware(http.HandlerFunc(ShareVideoHandler))).Methods("POST")
+	// short share links live outside /api: /s/{code}
+	r.HandleFunc("/s/{code:[A-Za-z0-9]+}", ShareRedirectHandler).Methods("GET")
 
 	authR := api.PathPrefix("").Subrouter()
 	authR.Use(JWTAuthMiddleware)
@@ -226,6 +252,10 @@ func main() {
 	authR.HandleFunc("/videos/{id:[0-9]+}/comments", CreateCommentHandler).Methods("POST")
 	authR.HandleFunc("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}", DeleteCommentHandler).Methods("DELETE")
 	authR.HandleFunc("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}", UpdateCommentHandler).Methods("PUT")
+	authR.HandleFunc("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}/like", LikeCommentHandler).Methods("POST")
+	authR.HandleFunc("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}/like", UnlikeCommentHandler).Methods("DELETE")
+	authR.HandleFunc("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}/pin", PinCommentHandler).Methods("PUT", "DELETE")
+	authR.HandleFunc("/videos/{id:[0-9]+}/comments/{commentId:[0-9]+}/heart", HeartCommentHandler).Methods("PUT", "DELETE")
 	authR.HandleFunc("/videos/{id:[0-9]+}/rating", RateVideoHandler).Methods("POST")
 	authR.HandleFunc("/videos/{id:[0-9]+}/rating", UnrateVideoHandler).Methods("DELETE")
 	authR.HandleFunc("/videos/{id:[0-9]+}/like", LikeVideoHandler).Methods("POST")
@@ -233,6 +263,43 @@ func main() {
 	authR.HandleFunc("/videos/{id:[0-9]+}/dislike", DislikeVideoHandler).Methods("POST")
 	authR.HandleFunc("/videos/{id:[0-9]+}/dislike", UndislikeVideoHandler).Methods("DELETE")
 	authR.HandleFunc("/user/videos", ListMyVideosHandler).Methods("GET")
+	// original file download and zip export of all own originals
+	authR.HandleFunc("/videos/{id:[0-9]+}/download", VideoDownloadHandler).Methods("GET")
+	authR.HandleFunc("/user/exports", CreateVideoExportHandler).Methods("POST")
+	authR.HandleFunc("/user/exports", ListVideoExportsHandler).Methods("GET")
+	authR.HandleFunc("/user/exports/{id:[0-9]+}/download", VideoExportDownloadHandler).Methods("GET")
+	authR.HandleFunc("/users/{id:[0-9]+}/follow", FollowUserHandler).Methods("POST")
+	authR.HandleFunc("/users/{id:[0-9]+}/follow", UnfollowUserHandler).Methods("DELETE")
+	authR.HandleFunc("/user/following", ListFollowingHandler).Methods("GET")
+	authR.HandleFunc("/users/{id:[0-9]+}/block", BlockUserHandler).Methods("POST")
+	authR.HandleFunc("/users/{id:[0-9]+}/block", UnblockUserHandler).Methods("DELETE")
+	authR.HandleFunc("/user/notifications", ListNotificationsHandler).Methods("GET")
+	authR.HandleFunc("/user/notifications/read", MarkNotificationsReadHandler).Methods("POST")
+	authR.HandleFunc("/videos/{id:[0-9]+}/progress", RecordWatchProgressHandler).Methods("POST")
+	authR.HandleFunc("/videos/{id:[0-9]+}/favorite", FavoriteVideoHandler).Methods("POST")
+	authR.HandleFunc("/videos/{id:[0-9]+}/favorite", UnfavoriteVideoHandler).Methods("DELETE")
+	authR.HandleFunc("/videos/{id:[0-9]+}/watch-later", AddWatchLaterHandler).Methods("POST")
+	authR.HandleFunc("/videos/{id:[0-9]+}/watch-later", RemoveWatchLaterHandler).Methods("DELETE")
+	authR.HandleFunc("/videos/{id:[0-9]+}/shares", VideoShareStatsHandler).Methods("GET")
+	authR.HandleFunc("/user/favorites", ListFavoritesHandler).Methods("GET")
+	authR.HandleFunc("/user/watch-later", ListWatchLaterHandler).Methods("GET")
+	authR.HandleFunc("/user/history", ListWatchHistoryHandler).Methods("GET")
+	authR.HandleFunc("/user/history", ClearWatchHistoryHandler).Methods("DELETE")
+	authR.HandleFunc("/user/history/{videoId:[0-9]+}", ClearWatchHistoryHandler).Methods("DELETE")
+	authR.HandleFunc("/user/history/pause", PauseWatchHistoryHandler).Methods("PUT")
+	authR.HandleFunc("/user/playlists", CreatePlaylistHandler).Methods("POST")
+	authR.HandleFunc("/user/playlists", ListMyPlaylistsHandler).Methods("GET")
+	authR.HandleFunc("/user/playlists/{id:[0-9]+}", GetMyPlaylistHandler).Methods("GET")
+	authR.HandleFunc("/user/playlists/{id:[0-9]+}", UpdatePlaylistHandler).Methods("PUT")
+	authR.HandleFunc("/user/playlists/{id:[0-9]+}", DeletePlaylistHandler).Methods("DELETE")
+	authR.HandleFunc("/user/playlists/{id:[0-9]+}/items", AddPlaylistItemHandler).Methods("POST")
+	authR.HandleFunc("/user/playlists/{id:[0-9]+}/items", ReorderPlaylistHandler).Methods("PUT")
+	authR.HandleFunc("/user/playlists/{id:[0-9]+}/items/{videoId:[0-9]+}", RemovePlaylistItemHandler).Methods("DELETE")
+	authR.HandleFunc("/feed/subscriptions", SubscriptionsFeedHandler).Methods("GET")
+	authR.HandleFunc("/user/saved-searches", CreateSavedSearchHandler).Methods("POST")
+	authR.HandleFunc("/user/saved-searches", ListSavedSearchesHandler).Methods("GET")
+	authR.HandleFunc("/user/saved-searches/{id:[0-9]+}", DeleteSavedSearchHandler).Methods("DELETE")
+	authR.HandleFunc("/user/saved-searches/{id:[0-9]+}/new", SavedSearchNewVideosHandler).Methods("GET")
 	authR.HandleFunc("/livestreams", CreateLiveStreamHandler).Methods("POST")
 	authR.HandleFunc("/livestreams/{id:[0-9]+}", UpdateLiveStreamHandler).Methods("PUT")
 	authR.HandleFunc("/livestreams/{id:[0-9]+}/status", UpdateLiveStreamStatusHandler).Methods("PUT")
@@ -255,6 +322,12 @@ func main() {
 	admin.HandleFunc("/categories/{id:[0-9]+}/move", AdminMoveCategoryParentHandler).Methods("PUT")
 	admin.HandleFunc("/categories/{id:[0-9]+}/counts", AdminCategoryCountsHandler).Methods("GET")
 	admin.HandleFunc("/categories/{id:[0-9]+}/reorder", AdminReorderCategoryHandler).Methods("PUT")
+	// comment edit history
+	admin.HandleFunc("/comments/{id:[0-9]+}/history", AdminCommentHistoryHandler).Methods("GET")
+	// search analytics
+	admin.HandleFunc("/search/top", AdminTopSearchesHandler).Methods("GET")
+	admin.HandleFunc("/search/zero-results", AdminZeroResultSearchesHandler).Methods("GET")
+	admin.HandleFunc("/search/click-through", AdminSearchClickThroughHandler).Methods("GET")
 	// tags moderation
 	admin.HandleFunc("/tags/banned", AdminListBannedTagsHandler).Methods("GET")
 	admin.HandleFunc("/tags/ban", AdminBanTagHandler).Methods("POST")
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	pq "github.com/lib/pq"
+)
+
+// maxCommentMentions caps how many distinct users one comment can mention (and notify).
+const maxCommentMentions = 10
+
+// CommentEntity is a structured span of a comment text. Offset and Length are in UTF-16 code
+// units so that clients can slice the text the way JavaScript strings do.
+type CommentEntity struct {
+	Type   string `json:"type"` // mention
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	UserID int    `json:"user_id"`
+	Handle string `json:"handle"`
+}
+
+type mentionToken struct {
+	Handle string // lowercased, without the @
+	Offset int
+	Length int
+}
+
+func isHandleRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.'
+}
+
+// validHandle reports whether h (already lowercased) can be used as a user handle.
+func validHandle(h string) bool {
+	if len(h) < 3 || len(h) > 30 || strings.HasPrefix(h, ".") || strings.HasSuffix(h, ".") {
+		return false
+	}
+	for _, r := range h {
+		if !isHandleRune(r) || r >= 'A' && r <= 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// reservedHandle reports whether h looks like the default handle user<id> of another account;
+// only the account with that id may keep it.
+func reservedHandle(h string, uid int) bool {
+	digits := strings.TrimPrefix(h, "user")
+	if digits == h || digits == "" {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return digits != strconv.Itoa(uid)
+}
+
+// parseMentions finds @handle tokens in text. An @ glued to a preceding word (e-mail addresses)
+// does not start a mention, and trailing dots are treated as punctuation.
+func parseMentions(text string) []mentionToken {
+	rs := []rune(text)
+	offs := make([]int, len(rs)+1)
+	for i, r := range rs {
+		n := 1
+		if r > 0xFFFF {
+			n = 2
+		}
+		offs[i+1] = offs[i] + n
+	}
+	var out []mentionToken
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '@' {
+			continue
+		}
+		if i > 0 && (unicode.IsLetter(rs[i-1]) || unicode.IsDigit(rs[i-1]) || rs[i-1] == '_' || rs[i-1] == '@') {
+			continue
+		}
+		j := i + 1
+		for j < len(rs) && isHandleRune(rs[j]) {
+			j++
+		}
+		end := j
+		for end > i+1 && rs[end-1] == '.' {
+			end--
+		}
+		if h := strings.ToLower(string(rs[i+1 : end])); validHandle(h) {
+			out = append(out, mentionToken{Handle: h, Offset: offs[i], Length: offs[end] - offs[i]})
+		}
+		i = j - 1
+	}
+	return out
+}
+
+// mentionEntities turns the tokens of text into entities for the resolved handles.
+func mentionEntities(text string, resolved map[string]int) []CommentEntity {
+	var out []CommentEntity
+	for _, t := range parseMentions(text) {
+		if id, ok := resolved[t.Handle]; ok {
+			out = append(out, CommentEntity{Type: "mention", Offset: t.Offset, Length: t.Length, UserID: id, Handle: t.Handle})
+		}
+	}
+	return out
+}
+
+// syncCommentMentions resolves the @handles of a comment, stores them in comment_mentions and
+// notifies users mentioned for the first time. The author and users blocked in either direction
+// are never resolved, so they get neither a link nor a notification.
+func syncCommentMentions(commentID, videoID, authorID int, text string) ([]CommentEntity, error) {
+	handles := []string{}
+	seen := map[string]bool{}
+	for _, t := range parseMentions(text) {
+		if !seen[t.Handle] && len(handles) < maxCommentMentions {
+			seen[t.Handle] = true
+			handles = append(handles, t.Handle)
+		}
+	}
+	resolved := map[string]int{}
+	ids := []int64{}
+	if len(handles) > 0 {
+		rows, err := db.Query(`SELECT u.id, u.handle FROM users u
+            WHERE u.handle = ANY($1::text[]) AND u.id <> $2
+              AND NOT EXISTS (SELECT 1 FROM user_blocks b
+                  WHERE (b.blocker_id = u.id AND b.blocked_id = $2) OR (b.blocker_id = $2 AND b.blocked_id = u.id))`,
+			pq.Array(handles), authorID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			var h string
+			if err := rows.Scan(&id, &h); err != nil {
+				return nil, err
+			}
+			resolved[h] = id
+			ids = append(ids, int64(id))
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := db.Exec("DELETE FROM comment_mentions WHERE comment_id=$1 AND user_id <> ALL($2::int[])", commentID, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		// only rows inserted now are new mentions; re-saving an edit does not notify again
+		if _, err := db.Exec(`WITH added AS (
+                INSERT INTO comment_mentions (comment_id, user_id)
+                SELECT $1, m FROM unnest($2::int[]) m
+                ON CONFLICT DO NOTHING
+                RETURNING user_id
+            )
+            INSERT INTO notifications (user_id, type, actor_id, video_id, comment_id)
+            SELECT user_id, 'mention', $3, $4, $1 FROM added`, commentID, pq.Array(ids), authorID, videoID); err != nil {
+			return nil, err
+		}
+	}
+	return mentionEntities(text, resolved), nil
+}
+
+// attachCommentEntities fills Entities of listed comments from their stored mentions.
+func attachCommentEntities(comments []Comment) {
+	ids := make([]int64, 0, len(comments))
+	for _, c := range comments {
+		if !c.Deleted {
+			ids = append(ids, int64(c.ID))
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	rows, err := db.Query(`SELECT cm.comment_id, u.id, u.handle FROM comment_mentions cm
+        JOIN users u ON u.id = cm.user_id
+        WHERE cm.comment_id = ANY($1::int[]) AND u.handle IS NOT NULL`, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	byComment := map[int]map[string]int{}
+	for rows.Next() {
+		var cid, uid int
+		var h string
+		if rows.Scan(&cid, &uid, &h) != nil {
+			continue
+		}
+		if byComment[cid] == nil {
+			byComment[cid] = map[string]int{}
+		}
+		byComment[cid][h] = uid
+	}
+	for i := range comments {
+		if resolved := byComment[comments[i].ID]; resolved != nil {
+			comments[i].Entities = mentionEntities(comments[i].Text, resolved)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	got := parseMentions("привет @Ivan_P, и 🎉 @anna.k. почта a@mail.ru @ab")
+	want := []mentionToken{
+		{Handle: "ivan_p", Offset: 7, Length: 7},
+		{Handle: "anna.k", Offset: 21, Length: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReservedHandle(t *testing.T) {
+	cases := []struct {
+		handle string
+		uid    int
+		want   bool
+	}{
+		{"user42", 7, true},
+		{"user42", 42, false},
+		{"user", 7, false},
+		{"user_42", 7, false},
+		{"username", 7, false},
+	}
+	for _, c := range cases {
+		if got := reservedHandle(c.handle, c.uid); got != c.want {
+			t.Errorf("reservedHandle(%q, %d) = %v, want %v", c.handle, c.uid, got, c.want)
+		}
+	}
+}
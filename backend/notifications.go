@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+// Notification is an in-app event for the current user, e.g. a mention in a comment.
+type Notification struct {
+	ID          int                `json:"id"`
+	Type        string             `json:"type"`
+	VideoID     *int               `json:"video_id,omitempty"`
+	CommentID   *int               `json:"comment_id,omitempty"`
+	CommentText string             `json:"comment_text,omitempty"`
+	CreatedAt   string             `json:"created_at"`
+	Read        bool               `json:"read"`
+	Actor       *NotificationActor `json:"actor,omitempty"`
+}
+
+// NotificationActor is the user who caused a notification.
+type NotificationActor struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+}
+
+// notificationVisible hides notifications caused by users the recipient has blocked.
+const notificationVisible = `NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = n.user_id AND b.blocked_id = n.actor_id)`
+
+// unreadNotificationsQuery counts the unread notifications of $1 that the list would show.
+const unreadNotificationsQuery = `SELECT COUNT(*) FROM notifications n WHERE n.user_id=$1 AND n.read_at IS NULL AND ` + notificationVisible
+
+// ListNotificationsHandler returns the user's notifications, newest first (offset cursor), with
+// the unread counter. ?unread=1 keeps only unread ones. Events from blocked users are hidden.
+func ListNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	offsets, err := decodeOffsetCursor(r.URL.Query().Get("cursor"), "notifications", 1)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	where := `n.user_id = $1 AND ` + notificationVisible
+	if isTruthy(r.URL.Query().Get("unread")) {
+		where += ` AND n.read_at IS NULL`
+	}
+	rows, err := db.Query(`SELECT n.id, n.type, n.video_id, n.comment_id, n.created_at, n.read_at IS NOT NULL,
+            CASE WHEN c.is_deleted THEN '' ELSE COALESCE(c.text,'') END,
+            n.actor_id, COALESCE(a.name,''), COALESCE(a.handle,'')
+        FROM notifications n
+        LEFT JOIN comments c ON c.id = n.comment_id
+        LEFT JOIN users a ON a.id = n.actor_id
+        WHERE `+where+`
+        ORDER BY n.created_at DESC, n.id DESC
+        LIMIT `+strconv.Itoa(limit+1)+` OFFSET `+strconv.Itoa(offsets[0]), uid)
+	if err != nil {
+		http.Error(w, "Ошибка получения уведомлений", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var videoID, commentID, actorID sql.NullInt32
+		var created time.Time
+		var actorName, actorHandle string
+		if err := rows.Scan(&n.ID, &n.Type, &videoID, &commentID, &created, &n.Read, &n.CommentText,
+			&actorID, &actorName, &actorHandle); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		n.CreatedAt = created.Format(time.RFC3339)
+		if videoID.Valid {
+			v := int(videoID.Int32)
+			n.VideoID = &v
+		}
+		if commentID.Valid {
+			c := int(commentID.Int32)
+			n.CommentID = &c
+		}
+		if actorID.Valid {
+			n.Actor = &NotificationActor{ID: int(actorID.Int32), Name: actorName, Handle: actorHandle}
+		}
+		out = append(out, n)
+	}
+	next := ""
+	if len(out) > limit {
+		out = out[:limit]
+		next = encodeOffsetCursor("notifications", offsets[0]+limit)
+	}
+	var unread int
+	_ = db.QueryRow(unreadNotificationsQuery, uid).Scan(&unread)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": out, "next_cursor": next, "unread_count": unread})
+}
+
+// MarkNotificationsReadHandler marks the given notifications as read, or all of them when the
+// body has no ids. Body: { ids?: number[] }
+func MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var req struct {
+		IDs []int64 `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Некорректный запрос", http.StatusBadRequest)
+			return
+		}
+	}
+	var err error
+	if len(req.IDs) > 0 {
+		_, err = db.Exec("UPDATE notifications SET read_at=NOW() WHERE user_id=$1 AND read_at IS NULL AND id = ANY($2::int[])", uid, pq.Array(req.IDs))
+	} else {
+		_, err = db.Exec("UPDATE notifications SET read_at=NOW() WHERE user_id=$1 AND read_at IS NULL", uid)
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	var unread int
+	_ = db.QueryRow(unreadNotificationsQuery, uid).Scan(&unread)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "unread_count": unread})
+}
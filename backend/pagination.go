@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 24
+	maxPageSize     = 100
+)
+
+// sortKey is one column of a keyset ordering over the wrapped listing query (alias x).
+type sortKey struct {
+	Column string // e.g. "x.likes"
+	Cast   string // SQL type the cursor value is cast to
+	Desc   bool
+	Value  func(v *Video) string
+}
+
+// listSort is a named, fully deterministic ordering (the last key must be unique).
+type listSort struct {
+	Name string
+	Keys []sortKey
+}
+
+var (
+	keyCreatedAt = sortKey{Column: "x.created_at", Cast: "timestamp", Desc: true, Value: func(v *Video) string {
+		return v.CreatedAt.Format("2006-01-02T15:04:05.999999")
+	}}
+	keyID = sortKey{Column: "x.id", Cast: "int", Desc: true, Value: func(v *Video) string {
+		return strconv.Itoa(v.ID)
+	}}
+)
+
+// videoSorts lists the orderings supported by video listings. New sorts only need an entry here
+// and a matching column in the listing query.
+var videoSorts = map[string]listSort{
+	"new": {Name: "new", Keys: []sortKey{keyCreatedAt, keyID}},
+	"likes": {Name: "likes", Keys: []sortKey{
+		{Column: "x.likes", Cast: "bigint", Desc: true, Value: func(v *Video) string { return strconv.Itoa(v.LikesCount) }},
+		keyCreatedAt, keyID,
+	}},
+	"trending": {Name: "trending", Keys: []sortKey{
+		{Column: "x.trending_score", Cast: "float8", Desc: true, Value: func(v *Video) string { return strconv.FormatFloat(v.TrendingScore, 'g', -1, 64) }},
+		keyCreatedAt, keyID,
+	}},
+	"relevance": {Name: "relevance", Keys: []sortKey{
+		{Column: "x.rank", Cast: "float8", Desc: true, Value: func(v *Video) string { return strconv.FormatFloat(v.SearchRank, 'g', -1, 64) }},
+		keyCreatedAt, keyID,
+	}},
+	"rating": {Name: "rating", Keys: []sortKey{
+		{Column: "x.rating_score", Cast: "float8", Desc: true, Value: func(v *Video) string { return strconv.FormatFloat(v.RatingScore, 'g', -1, 64) }},
+		keyCreatedAt, keyID,
+	}},
+	"views": {Name: "views", Keys: []sortKey{
+		{Column: "x.views_count", Cast: "int", Desc: true, Value: func(v *Video) string { return strconv.Itoa(v.ViewsCount) }},
+		keyCreatedAt, keyID,
+	}},
+	"comments": {Name: "comments", Keys: []sortKey{
+		{Column: "x.comments", Cast: "bigint", Desc: true, Value: func(v *Video) string { return strconv.Itoa(v.CommentsCount) }},
+		keyCreatedAt, keyID,
+	}},
+	"duration": {Name: "duration", Keys: []sortKey{
+		{Column: "x.duration", Cast: "float8", Desc: true, Value: func(v *Video) string { return strconv.FormatFloat(v.DurationSeconds, 'g', -1, 64) }},
+		keyCreatedAt, keyID,
+	}},
+	// unknown durations (0) go last: they sort as infinity
+	"duration_asc": {Name: "duration_asc", Keys: []sortKey{
+		{Column: "(CASE WHEN x.duration > 0 THEN x.duration ELSE 'Infinity'::float8 END)", Cast: "float8", Value: func(v *Video) string {
+			if v.DurationSeconds <= 0 {
+				return "Infinity"
+			}
+			return strconv.FormatFloat(v.DurationSeconds, 'g', -1, 64)
+		}},
+		keyCreatedAt, keyID,
+	}},
+	// trigram similarity rank of the typo-tolerant search fallback
+	"fuzzy": {Name: "fuzzy", Keys: []sortKey{
+		{Column: "x.rank", Cast: "float8", Desc: true, Value: func(v *Video) string { return strconv.FormatFloat(v.SearchRank, 'g', -1, 64) }},
+		keyCreatedAt, keyID,
+	}},
+}
+
+// listCursor is the decoded form of the opaque next_cursor token.
+type listCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	// Fuzzy keeps a search in typo-tolerant mode on later pages, whatever its sort
+	Fuzzy bool `json:"f,omitempty"`
+}
+
+func encodeCursor(c listCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var c listCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// pageParams are the pagination query parameters of a listing request.
+type pageParams struct {
+	Limit  int
+	Cursor *listCursor
+	Legacy bool // respond with a bare JSON array instead of the envelope
+	Fuzzy  bool // carried through the cursor, see listCursor
+}
+
+// parsePageParams reads limit/cursor/legacy. Legacy requests without an explicit limit get
+// maxPageSize rows (the rest is reachable through X-Next-Cursor); every limit is capped at maxPageSize.
+func parsePageParams(r *http.Request, sort listSort) (pageParams, error) {
+	q := r.URL.Query()
+	p := pageParams{Limit: defaultPageSize}
+	p.Legacy = isTruthy(q.Get("legacy"))
+	if l := strings.TrimSpace(q.Get("limit")); l != "" {
+		n, err := parsePageLimit(r)
+		if err != nil {
+			return p, err
+		}
+		p.Limit = n
+	} else if p.Legacy {
+		p.Limit = maxPageSize
+	}
+	if c := strings.TrimSpace(q.Get("cursor")); c != "" {
+		cur, err := decodeCursor(c)
+		if err != nil || cur.Sort != sort.Name || len(cur.Values) != len(sort.Keys) {
+			return p, fmt.Errorf("invalid cursor")
+		}
+		p.Cursor = &cur
+		p.Fuzzy = cur.Fuzzy
+	}
+	return p, nil
+}
+
+// isTruthy reports whether a boolean query flag is set ("1" or "true").
+func isTruthy(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s == "1" || s == "true"
+}
+
+// parsePageLimit reads ?limit= with the default page size and the maxPageSize cap.
+func parsePageLimit(r *http.Request) (int, error) {
+	l := strings.TrimSpace(r.URL.Query().Get("limit"))
+	if l == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(l)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid limit")
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
+
+// encodeOffsetCursor builds an opaque cursor for ranked feeds where keyset pagination does not
+// apply (the ranking is computed per request); it stores one offset per merged source.
+func encodeOffsetCursor(name string, offsets ...int) string {
+	c := listCursor{Sort: name, Values: make([]string, len(offsets))}
+	for i, o := range offsets {
+		c.Values[i] = strconv.Itoa(o)
+	}
+	return encodeCursor(c)
+}
+
+// decodeOffsetCursor returns n zero offsets for an empty cursor.
+func decodeOffsetCursor(s, name string, n int) ([]int, error) {
+	out := make([]int, n)
+	if strings.TrimSpace(s) == "" {
+		return out, nil
+	}
+	c, err := decodeCursor(s)
+	if err != nil || c.Sort != name || len(c.Values) != n {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	for i, v := range c.Values {
+		if out[i], err = strconv.Atoi(v); err != nil || out[i] < 0 {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+	}
+	return out, nil
+}
+
+// paginateQuery wraps a listing query (without ORDER BY) into a keyset-paginated one.
+// One extra row is fetched to know whether there is a next page.
+func paginateQuery(inner string, params []any, sort listSort, p pageParams) (string, []any) {
+	query := "SELECT * FROM (" + inner + ") x"
+	if p.Cursor != nil {
+		placeholders := make([]string, len(sort.Keys))
+		for i, k := range sort.Keys {
+			params = append(params, p.Cursor.Values[i])
+			placeholders[i] = "$" + strconv.Itoa(len(params)) + "::" + k.Cast
+		}
+		// (a < $1) OR (a = $1 AND b < $2) OR ... — works for mixed directions
+		ors := []string{}
+		for i, k := range sort.Keys {
+			ands := []string{}
+			for j := 0; j < i; j++ {
+				ands = append(ands, sort.Keys[j].Column+" = "+placeholders[j])
+			}
+			op := " > "
+			if k.Desc {
+				op = " < "
+			}
+			ands = append(ands, k.Column+op+placeholders[i])
+			ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		}
+		query += " WHERE " + strings.Join(ors, " OR ")
+	}
+	order := make([]string, len(sort.Keys))
+	for i, k := range sort.Keys {
+		order[i] = k.Column + " ASC"
+		if k.Desc {
+			order[i] = k.Column + " DESC"
+		}
+	}
+	query += " ORDER BY " + strings.Join(order, ", ")
+	if p.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", p.Limit+1)
+	}
+	return query, params
+}
+
+// trimPage drops the look-ahead row and returns the cursor for the following page.
+func trimPage(items []Video, sort listSort, p pageParams) ([]Video, string) {
+	if p.Limit <= 0 || len(items) <= p.Limit {
+		return items, ""
+	}
+	items = items[:p.Limit]
+	last := &items[len(items)-1]
+	c := listCursor{Sort: sort.Name, Values: make([]string, len(sort.Keys)), Fuzzy: p.Fuzzy}
+	for i, k := range sort.Keys {
+		c.Values[i] = k.Value(last)
+	}
+	return items, encodeCursor(c)
+}
+
+type videoPage struct {
+	Items      []Video `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	// Facets is only filled by category listings with include_descendants=1
+	Facets []CategoryFacet `json:"facets,omitempty"`
+	// Fuzzy is set when q matched nothing exactly and typo-tolerant matching was used instead
+	Fuzzy      bool   `json:"fuzzy,omitempty"`
+	DidYouMean string `json:"did_you_mean,omitempty"`
+	// SearchID identifies the search_log entry of a first search page
+	SearchID int64 `json:"search_id,omitempty"`
+}
+
+// writeVideoPage writes either the paginated envelope or, for legacy clients, a bare array.
+func writeVideoPage(w http.ResponseWriter, items []Video, next string, p pageParams) {
+	w.Header().Set("Content-Type", "application/json")
+	var err error
+	if p.Legacy {
+		if next != "" {
+			w.Header().Set("X-Next-Cursor", next)
+		}
+		err = json.NewEncoder(w).Encode(items)
+	} else {
+		err = json.NewEncoder(w).Encode(videoPage{Items: items, NextCursor: next})
+	}
+	if err != nil {
+		log.Printf("writeVideoPage: JSON encode error: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := listCursor{Sort: "likes", Values: []string{"5", "2024-01-02T03:04:05.123456", "42"}}
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil || got.Sort != c.Sort || strings.Join(got.Values, "|") != strings.Join(c.Values, "|") {
+		t.Fatalf("round trip mismatch: %+v %v", got, err)
+	}
+	if _, err := decodeCursor("!!not-base64!!"); err == nil {
+		t.Fatalf("garbage cursor should fail")
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	sort := videoSorts["new"]
+	p, err := parsePageParams(httptest.NewRequest("GET", "/api/videos?limit=1000", nil), sort)
+	if err != nil || p.Limit != maxPageSize || p.Legacy {
+		t.Fatalf("limit should be capped: %+v %v", p, err)
+	}
+	p, _ = parsePageParams(httptest.NewRequest("GET", "/api/videos?legacy=1", nil), sort)
+	if !p.Legacy || p.Limit != maxPageSize {
+		t.Fatalf("legacy without limit should be capped: %+v", p)
+	}
+	other := encodeCursor(listCursor{Sort: "likes", Values: []string{"1", "2", "3"}})
+	if _, err := parsePageParams(httptest.NewRequest("GET", "/api/videos?cursor="+other, nil), sort); err == nil {
+		t.Fatalf("cursor of another sort should be rejected")
+	}
+}
+
+func TestPaginateQueryKeyset(t *testing.T) {
+	sort := videoSorts["likes"]
+	cur := listCursor{Sort: "likes", Values: []string{"5", "2024-01-02T03:04:05", "42"}}
+	q, params := paginateQuery("SELECT 1", []any{"x"}, sort, pageParams{Limit: 10, Cursor: &cur})
+	if len(params) != 4 {
+		t.Fatalf("expected 4 params, got %d", len(params))
+	}
+	for _, want := range []string{"(x.likes < $2::bigint)", "x.likes = $2::bigint AND x.created_at < $3::timestamp", "ORDER BY x.likes DESC, x.created_at DESC, x.id DESC", "LIMIT 11"} {
+		if !strings.Contains(q, want) {
+			t.Fatalf("query %q does not contain %q", q, want)
+		}
+	}
+}
+
+func TestTrimPageBuildsCursor(t *testing.T) {
+	sort := videoSorts["new"]
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	items := []Video{{ID: 3, CreatedAt: ts}, {ID: 2, CreatedAt: ts}, {ID: 1, CreatedAt: ts}}
+	page, next := trimPage(items, sort, pageParams{Limit: 2})
+	if len(page) != 2 || next == "" {
+		t.Fatalf("expected 2 items and a cursor, got %d %q", len(page), next)
+	}
+	c, _ := decodeCursor(next)
+	if c.Values[0] != "2024-05-06T07:08:09" || c.Values[1] != "2" {
+		t.Fatalf("unexpected cursor values %v", c.Values)
+	}
+	if _, next := trimPage(items, sort, pageParams{Limit: 5}); next != "" {
+		t.Fatalf("last page should have no cursor")
+	}
+}
+
+func TestFuzzyModeSurvivesCursor(t *testing.T) {
+	sort := videoSorts["new"]
+	items := []Video{{ID: 2}, {ID: 1}}
+	_, next := trimPage(items, sort, pageParams{Limit: 1, Fuzzy: true})
+	p, err := parsePageParams(httptest.NewRequest("GET", "/api/videos?cursor="+next, nil), sort)
+	if err != nil || !p.Fuzzy {
+		t.Fatalf("fuzzy flag should come back from the cursor: %+v %v", p, err)
+	}
+	_, next = trimPage(items, sort, pageParams{Limit: 1})
+	if p, _ := parsePageParams(httptest.NewRequest("GET", "/api/videos?cursor="+next, nil), sort); p.Fuzzy {
+		t.Fatalf("plain cursor should not be fuzzy")
+	}
+}
+
+func TestDurationAscCursorForUnknownDuration(t *testing.T) {
+	key := videoSorts["duration_asc"].Keys[0]
+	if got := key.Value(&Video{}); got != "Infinity" {
+		t.Fatalf("unknown duration should sort last, cursor value %q", got)
+	}
+	if got := key.Value(&Video{DurationSeconds: 12.5}); got != "12.5" {
+		t.Fatalf("unexpected cursor value %q", got)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
+)
+
+// maxPlaylistItems caps the size of one playlist.
+const maxPlaylistItems = 500
+
+// Playlist is a user's ordered collection of videos. Key identifies it in shareable links.
+type Playlist struct {
+	ID          int       `json:"id"`
+	Key         string    `json:"key"`
+	UserID      int       `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"` // private, unlisted or public
+	ItemsCount  int       `json:"items_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// ContainsVideo answers ?video_id= on the owner's list ("add to playlist" menus)
+	ContainsVideo *bool `json:"contains_video,omitempty"`
+}
+
+// items_count only counts videos that are visible in listings
+const playlistColumns = `p.id, p.share_key, p.user_id, COALESCE(u.name,''), p.title, p.description, p.visibility,
+        (SELECT COUNT(*) FROM playlist_items pi JOIN videos v ON v.id = pi.video_id
+            WHERE pi.playlist_id = p.id AND v.is_approved = TRUE),
+        p.created_at, p.updated_at`
+
+const playlistFrom = `FROM playlists p JOIN users u ON u.id = p.user_id`
+
+// scanPlaylists reads rows of playlistColumns, followed by the contains_video flag if withContains.
+func scanPlaylists(rows *sql.Rows, withContains bool) ([]Playlist, error) {
+	defer rows.Close()
+	out := []Playlist{}
+	for rows.Next() {
+		var p Playlist
+		dest := []any{&p.ID, &p.Key, &p.UserID, &p.UserName, &p.Title, &p.Description, &p.Visibility,
+			&p.ItemsCount, &p.CreatedAt, &p.UpdatedAt}
+		if withContains {
+			var contains bool
+			dest = append(dest, &contains)
+			p.ContainsVideo = &contains
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func normalizePlaylistVisibility(s string) (string, bool) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "private", "unlisted", "public":
+		return s, true
+	}
+	return "", false
+}
+
+func newPlaylistKey() (string, error) {
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// loadPlaylist returns the playlist matching cond (over playlists p), or sql.ErrNoRows.
+func loadPlaylist(cond string, args ...any) (*Playlist, error) {
+	rows, err := db.Query(`SELECT `+playlistColumns+` `+playlistFrom+` WHERE `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanPlaylists(rows, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &items[0], nil
+}
+
+// ownPlaylist loads a playlist of the current user by {id}, writing 404 if it is someone else's.
+func ownPlaylist(w http.ResponseWriter, r *http.Request) (*Playlist, bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	p, err := loadPlaylist("p.id=$1 AND p.user_id=$2", id, uid)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Плейлист не найден", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return nil, false
+	}
+	return p, true
+}
+
+// CreatePlaylistHandler creates a playlist. Body: { title, description?, visibility? (private) }
+func CreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var req struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		http.Error(w, "Название обязательно", http.StatusBadRequest)
+		return
+	}
+	visibility := "private"
+	if strings.TrimSpace(req.Visibility) != "" {
+		var ok bool
+		if visibility, ok = normalizePlaylistVisibility(req.Visibility); !ok {
+			http.Error(w, "Недопустимая видимость", http.StatusBadRequest)
+			return
+		}
+	}
+	key, err := newPlaylistKey()
+	if err != nil {
+		http.Error(w, "Ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	var id int
+	if err := db.QueryRow(`INSERT INTO playlists (user_id, share_key, title, description, visibility)
+        VALUES ($1,$2,$3,$4,$5) RETURNING id`, uid, key, title, strings.TrimSpace(req.Description), visibility).Scan(&id); err != nil {
+		log.Printf("CreatePlaylistHandler: insert error user=%d: %v", uid, err)
+		http.Error(w, "Не удалось создать плейлист", http.StatusInternalServerError)
+		return
+	}
+	p, err := loadPlaylist("p.id=$1", id)
+	if err != nil {
+		http.Error(w, "Ошибка получения плейлиста", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// ListMyPlaylistsHandler lists the current user's playlists, recently updated first.
+// ?video_id= adds contains_video to each playlist.
+func ListMyPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	query := `SELECT ` + playlistColumns
+	params := []any{uid}
+	withContains := false
+	if vid, err := strconv.Atoi(r.URL.Query().Get("video_id")); err == nil {
+		params = append(params, vid)
+		query += `, EXISTS (SELECT 1 FROM playlist_items pi WHERE pi.playlist_id = p.id AND pi.video_id = $2)`
+		withContains = true
+	}
+	rows, err := db.Query(query+` `+playlistFrom+` WHERE p.user_id=$1 ORDER BY p.updated_at DESC, p.id DESC`, params...)
+	if err != nil {
+		http.Error(w, "Ошибка получения плейлистов", http.StatusInternalServerError)
+		return
+	}
+	out, err := scanPlaylists(rows, withContains)
+	if err != nil {
+		http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ListUserPlaylistsHandler lists the public playlists of a creator.
+func ListUserPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	rows, err := db.Query(`SELECT `+playlistColumns+` `+playlistFrom+`
+        WHERE p.user_id=$1 AND p.visibility='public' ORDER BY p.updated_at DESC, p.id DESC`, id)
+	if err != nil {
+		http.Error(w, "Ошибка получения плейлистов", http.StatusInternalServerError)
+		return
+	}
+	out, err := scanPlaylists(rows, false)
+	if err != nil {
+		http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// UpdatePlaylistHandler changes title, description and/or visibility; omitted fields are kept.
+func UpdatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	if req.Title != nil {
+		if p.Title = strings.TrimSpace(*req.Title); p.Title == "" {
+			http.Error(w, "Название обязательно", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Description != nil {
+		p.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Visibility != nil {
+		if p.Visibility, ok = normalizePlaylistVisibility(*req.Visibility); !ok {
+			http.Error(w, "Недопустимая видимость", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := db.Exec("UPDATE playlists SET title=$1, description=$2, visibility=$3, updated_at=NOW() WHERE id=$4",
+		p.Title, p.Description, p.Visibility, p.ID); err != nil {
+		http.Error(w, "Не удалось обновить плейлист", http.StatusInternalServerError)
+		return
+	}
+	p, err := loadPlaylist("p.id=$1", p.ID)
+	if err != nil {
+		http.Error(w, "Ошибка получения плейлиста", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// DeletePlaylistHandler removes a playlist with its items.
+func DeletePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+	if _, err := db.Exec("DELETE FROM playlists WHERE id=$1", p.ID); err != nil {
+		http.Error(w, "Не удалось удалить плейлист", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddPlaylistItemHandler appends an approved video to the playlist (idempotent).
+// Body: { video_id }
+func AddPlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		VideoID int `json:"video_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.VideoID <= 0 {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	var approved bool
+	if err := db.QueryRow("SELECT is_approved FROM videos WHERE id=$1", req.VideoID).Scan(&approved); err != nil || !approved {
+		http.Error(w, "Видео не найдено", http.StatusNotFound)
+		return
+	}
+	var count int
+	_ = db.QueryRow("SELECT COUNT(*) FROM playlist_items WHERE playlist_id=$1", p.ID).Scan(&count)
+	if count >= maxPlaylistItems {
+		http.Error(w, "Плейлист заполнен", http.StatusConflict)
+		return
+	}
+	if _, err := db.Exec(`INSERT INTO playlist_items (playlist_id, video_id, position)
+        SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM playlist_items WHERE playlist_id=$1
+        ON CONFLICT DO NOTHING`, p.ID, req.VideoID); err != nil {
+		log.Printf("AddPlaylistItemHandler: insert error playlist=%d video=%d: %v", p.ID, req.VideoID, err)
+		http.Error(w, "Не удалось добавить видео", http.StatusInternalServerError)
+		return
+	}
+	_, _ = db.Exec("UPDATE playlists SET updated_at=NOW() WHERE id=$1", p.ID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"playlist_id": p.ID, "video_id": req.VideoID, "added": true})
+}
+
+// RemovePlaylistItemHandler removes a video from the playlist (idempotent).
+func RemovePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+	vid, _ := strconv.Atoi(mux.Vars(r)["videoId"])
+	if _, err := db.Exec("DELETE FROM playlist_items WHERE playlist_id=$1 AND video_id=$2", p.ID, vid); err != nil {
+		http.Error(w, "Не удалось удалить видео", http.StatusInternalServerError)
+		return
+	}
+	_, _ = db.Exec("UPDATE playlists SET updated_at=NOW() WHERE id=$1", p.ID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"playlist_id": p.ID, "video_id": vid, "added": false})
+}
+
+// ReorderPlaylistHandler sets the order of the items. Body: { video_ids: [...] } listing every
+// video of the playlist exactly once, in the new order.
+func ReorderPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		VideoIDs []int64 `json:"video_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	seen := map[int64]bool{}
+	for _, id := range req.VideoIDs {
+		if seen[id] {
+			http.Error(w, "Видео повторяется в списке", http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+	// the list must match the current items exactly, otherwise a concurrent add would be lost
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE playlist_items pi SET position = o.pos
+        FROM unnest($2::int[]) WITH ORDINALITY AS o(video_id, pos)
+        WHERE pi.playlist_id = $1 AND pi.video_id = o.video_id`, p.ID, pq.Array(req.VideoIDs))
+	if err != nil {
+		log.Printf("ReorderPlaylistHandler: update error playlist=%d: %v", p.ID, err)
+		http.Error(w, "Не удалось изменить порядок", http.StatusInternalServerError)
+		return
+	}
+	var total int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM playlist_items WHERE playlist_id=$1", p.ID).Scan(&total); err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); int(n) != len(req.VideoIDs) || total != len(req.VideoIDs) {
+		http.Error(w, "Список не совпадает с содержимым плейлиста", http.StatusConflict)
+		return
+	}
+	if _, err := tx.Exec("UPDATE playlists SET updated_at=NOW() WHERE id=$1", p.ID); err != nil || tx.Commit() != nil {
+		http.Error(w, "Не удалось изменить порядок", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"playlist_id": p.ID, "video_ids": req.VideoIDs})
+}
+
+// GetMyPlaylistHandler returns one of the current user's playlists with its items.
+func GetMyPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+	writePlaylistWithItems(w, r, p)
+}
+
+// GetPlaylistHandler serves a shared playlist by key: public and unlisted ones to anyone with
+// the link, private ones to their owner only.
+func GetPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := loadPlaylist("p.share_key=$1", mux.Vars(r)["key"])
+	if err == sql.ErrNoRows {
+		http.Error(w, "Плейлист не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	if uid, _ := r.Context().Value(ctxKeyUserID).(int); p.Visibility == "private" && uid != p.UserID {
+		http.Error(w, "Плейлист не найден", http.StatusNotFound)
+		return
+	}
+	writePlaylistWithItems(w, r, p)
+}
+
+// writePlaylistWithItems writes {"playlist","items","next_cursor"}; items are approved videos in
+// playlist order with the listing Video JSON, paged with an offset cursor.
+func writePlaylistWithItems(w http.ResponseWriter, r *http.Request, p *Playlist) {
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	offsets, err := decodeOffsetCursor(r.URL.Query().Get("cursor"), "playlist", 1)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	rows, err := db.Query(`SELECT `+videoListColumns+`
+        FROM playlist_items pi
+        JOIN videos v ON v.id = pi.video_id
+        `+videoListJoins+`
+        WHERE pi.playlist_id = $1 AND v.is_approved = TRUE
+        ORDER BY pi.position, pi.added_at
+        LIMIT `+strconv.Itoa(limit+1)+` OFFSET `+strconv.Itoa(offsets[0]), p.ID)
+	if err != nil {
+		log.Printf("writePlaylistWithItems: query error playlist=%d: %v", p.ID, err)
+		http.Error(w, "Ошибка получения видео", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []Video{}
+	for rows.Next() {
+		var v Video
+		if err := scanVideo(rows, &v); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, v)
+	}
+	next := ""
+	if len(out) > limit {
+		out = out[:limit]
+		next = encodeOffsetCursor("playlist", offsets[0]+limit)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"playlist": p, "items": out, "next_cursor": next})
+}
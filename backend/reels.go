@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+const (
+	reelsPageSize     = 10
+	reelsPrefetchSize = 3
+	// anonymous sessions are forgotten after this long without being served anything
+	reelsSessionTTL = 7 * 24 * time.Hour
+)
+
+var reelsSessionRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ReelPrefetch is a hint for the client to warm up upcoming reels before they are requested.
+type ReelPrefetch struct {
+	ID           int    `json:"id"`
+	VideoURL     string `json:"video_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+type reelsFeedPage struct {
+	Items    []Video        `json:"items"`
+	Session  string         `json:"session,omitempty"`
+	Prefetch []ReelPrefetch `json:"prefetch"`
+}
+
+func newReelsSession() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// reelPlaybackURL prefers the lighter 480p variant for feed playback and prefetch.
+func reelPlaybackURL(v *Video) string {
+	if v.Has480 {
+		return fmt.Sprintf("/api/videos/%d/content?quality=480p", v.ID)
+	}
+	return fmt.Sprintf("/api/videos/%d/content", v.ID)
+}
+
+// ReelsFeedHandler returns an endless sequence of approved reels. Served reels are remembered per
+// user, or per anonymous session token (X-Reels-Session header or ?session=), and are not repeated
+// until the viewer has seen them all, after which the sequence starts over.
+// ?limit= defaults to 10, max 50.
+func ReelsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	limit := reelsPageSize
+	if l := strings.TrimSpace(r.URL.Query().Get("limit")); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			if v > 50 {
+				v = 50
+			}
+			limit = v
+		}
+	}
+	var viewer, session string
+	if uid, ok := r.Context().Value(ctxKeyUserID).(int); ok {
+		viewer = "u:" + strconv.Itoa(uid)
+	} else {
+		session = strings.ToLower(strings.TrimSpace(r.Header.Get("X-Reels-Session")))
+		if session == "" {
+			session = strings.ToLower(strings.TrimSpace(r.URL.Query().Get("session")))
+		}
+		if !reelsSessionRe.MatchString(session) {
+			var err error
+			if session, err = newReelsSession(); err != nil {
+				http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+				return
+			}
+		}
+		viewer = "s:" + session
+	}
+
+	items, err := queryUnseenReels(viewer, limit+reelsPrefetchSize)
+	if err == nil && len(items) == 0 {
+		// everything has been served: start a new cycle
+		if _, err = db.Exec("DELETE FROM reel_impressions WHERE viewer=$1", viewer); err == nil {
+			items, err = queryUnseenReels(viewer, limit+reelsPrefetchSize)
+		}
+	}
+	if err != nil {
+		log.Printf("ReelsFeedHandler: query error viewer=%s: %v", viewer, err)
+		http.Error(w, "Ошибка получения рилсов", http.StatusInternalServerError)
+		return
+	}
+	page := reelsFeedPage{Items: items, Session: session, Prefetch: []ReelPrefetch{}}
+	if len(items) > limit {
+		// look-ahead rows are not marked as served; they open the next page
+		for i := range items[limit:] {
+			v := &items[limit+i]
+			page.Prefetch = append(page.Prefetch, ReelPrefetch{ID: v.ID, VideoURL: reelPlaybackURL(v), ThumbnailURL: fmt.Sprintf("/api/videos/%d/thumbnail", v.ID)})
+		}
+		page.Items = items[:limit]
+	}
+	ids := make([]int64, len(page.Items))
+	for i, v := range page.Items {
+		ids[i] = int64(v.ID)
+	}
+	if len(ids) > 0 {
+		if _, err := db.Exec(`INSERT INTO reel_impressions (viewer, video_id)
+            SELECT $1, UNNEST($2::int[])
+            ON CONFLICT (viewer, video_id) DO UPDATE SET served_at = NOW()`, viewer, pq.Array(ids)); err != nil {
+			log.Printf("ReelsFeedHandler: impressions error viewer=%s: %v", viewer, err)
+		}
+	}
+	if session != "" {
+		w.Header().Set("X-Reels-Session", session)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// queryUnseenReels returns approved reels not yet served to the viewer, trending first.
+// The order is deterministic so that prefetch hints match the next page.
+func queryUnseenReels(viewer string, limit int) ([]Video, error) {
+	rows, err := db.Query(`SELECT `+videoListColumns+`
+        FROM videos v
+        `+videoListJoins+`
+        WHERE v.is_approved = TRUE AND v.is_reel = TRUE
+          AND NOT EXISTS (SELECT 1 FROM reel_impressions ri WHERE ri.viewer = $1 AND ri.video_id = v.id)
+        ORDER BY COALESCE(vs.score, 0) DESC, v.created_at DESC, v.id DESC
+        LIMIT `+strconv.Itoa(limit), viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Video{}
+	for rows.Next() {
+		var v Video
+		if err := scanVideo(rows, &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// startReelImpressionsPruner periodically forgets idle anonymous reel sessions.
+func startReelImpressionsPruner() {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		if _, err := db.Exec(`DELETE FROM reel_impressions ri
+            WHERE ri.viewer LIKE 's:%' AND NOT EXISTS (
+                SELECT 1 FROM reel_impressions r2 WHERE r2.viewer = ri.viewer AND r2.served_at > $1)`,
+			time.Now().Add(-reelsSessionTTL)); err != nil {
+			log.Printf("reels: prune impressions error: %v", err)
+		}
+		<-t.C
+	}
+}
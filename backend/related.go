@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// relatedCache keeps encoded related lists per video and limit for a few minutes.
+var relatedCache = newTTLCache(10*time.Minute, 5000)
+
+// relatedScoredCTE scores approved candidates against source video $1:
+// shared tags 3 each, same category 4, sibling or parent/child category 2, same creator 2.
+const relatedScoredCTE = `
+WITH src AS (
+    SELECT s.id, s.user_id, s.category_id, sc.parent_id AS cat_parent
+    FROM videos s LEFT JOIN categories sc ON sc.id = s.category_id
+    WHERE s.id = $1
+),
+src_tags AS (SELECT tag_id FROM video_tags WHERE video_id = $1),
+cand AS (
+    SELECT x.id,
+        3.0 * (SELECT COUNT(*) FROM video_tags vt WHERE vt.video_id = x.id AND vt.tag_id IN (SELECT tag_id FROM src_tags))
+        + CASE
+            WHEN x.category_id = src.category_id THEN 4
+            WHEN xc.parent_id = src.cat_parent THEN 2
+            WHEN x.category_id = src.cat_parent OR xc.parent_id = src.category_id THEN 2
+            ELSE 0
+          END
+        + CASE WHEN x.user_id = src.user_id THEN 2 ELSE 0 END AS similarity
+    FROM videos x
+    CROSS JOIN src
+    LEFT JOIN categories xc ON xc.id = x.category_id
+    WHERE x.is_approved = TRUE AND x.id <> src.id
+)`
+
+// RelatedVideosHandler returns approved videos similar to the given one, ranked by similarity
+// plus likes; the trending score only breaks ties, as its scale would swamp the similarity.
+// ?limit= defaults to 12, max 50.
+func RelatedVideosHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	limit := 12
+	if l := strings.TrimSpace(r.URL.Query().Get("limit")); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			if v > 50 {
+				v = 50
+			}
+			limit = v
+		}
+	}
+	cacheKey := fmt.Sprintf("%d:%d", id, limit)
+	if body, ok := relatedCache.Get(cacheKey); ok {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+		return
+	}
+	var approved bool
+	if err := db.QueryRow("SELECT is_approved FROM videos WHERE id=$1", id).Scan(&approved); err != nil || !approved {
+		http.Error(w, "Видео не найдено", http.StatusNotFound)
+		return
+	}
+	rows, err := db.Query(relatedScoredCTE+`
+        SELECT `+videoListColumns+`
+        FROM cand
+        JOIN videos v ON v.id = cand.id
+        `+videoListJoins+`
+        ORDER BY cand.similarity
+            + 0.5 * LN(1 + (SELECT COUNT(*) FROM likes l2 WHERE l2.video_id = v.id)) DESC,
+            COALESCE(vs.score, 0) DESC, v.created_at DESC, v.id DESC
+        LIMIT `+strconv.Itoa(limit), id)
+	if err != nil {
+		log.Printf("RelatedVideosHandler: query error id=%d: %v", id, err)
+		http.Error(w, "Ошибка получения видео", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []Video{}
+	for rows.Next() {
+		var v Video
+		if err := scanVideo(rows, &v); err != nil {
+			log.Printf("RelatedVideosHandler: scan error id=%d: %v", id, err)
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, v)
+	}
+	body, err := json.Marshal(videoPage{Items: out})
+	if err != nil {
+		http.Error(w, "Ошибка формирования ответа", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+	relatedCache.Set(cacheKey, body)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const maxSavedSearchesPerUser = 50
+
+// savedSearchFilters are the ListVideosHandler parameters a saved search may keep.
+// sort is stored for re-running the search in the client, it does not affect matching.
+// min_rating is left out: a just approved video has no ratings yet, so it could never match.
+var savedSearchFilters = []string{"q", "category", "categories", "include_descendants", "tags",
+	"creator", "reels", "has_products", "min_duration", "max_duration", "sort"}
+
+type SavedSearch struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Params     string    `json:"params"`
+	NewCount   int       `json:"new_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// normalizeSavedSearchParams keeps known, non-empty listing filters and encodes them in a stable
+// order. It returns "" when no filter besides sort remains.
+func normalizeSavedSearchParams(raw string) string {
+	in, err := url.ParseQuery(strings.TrimPrefix(strings.TrimSpace(raw), "?"))
+	if err != nil {
+		return ""
+	}
+	out := url.Values{}
+	for _, k := range savedSearchFilters {
+		if v := strings.TrimSpace(in.Get(k)); v != "" {
+			if len([]rune(v)) > 200 {
+				v = string([]rune(v)[:200])
+			}
+			out.Set(k, v)
+		}
+	}
+	if len(out) == 0 || (len(out) == 1 && out.Get("sort") != "") {
+		return ""
+	}
+	return out.Encode()
+}
+
+// savedSearchQuery builds the listing query of saved params, as ListVideosHandler would.
+func savedSearchQuery(params string) videoListQuery {
+	r := &http.Request{URL: &url.URL{RawQuery: params}}
+	return buildVideoListQuery(r, false)
+}
+
+// evaluateSavedSearches records the just approved video as a match of every saved search
+// (of other users) whose filters it satisfies. Runs in the background after approval.
+func evaluateSavedSearches(videoID int) {
+	rows, err := db.Query(`SELECT s.id, s.params FROM saved_searches s
+        JOIN videos v ON v.id = $1
+        WHERE s.user_id <> v.user_id AND v.is_approved = TRUE
+          AND NOT EXISTS (SELECT 1 FROM saved_search_matches m WHERE m.saved_search_id = s.id AND m.video_id = v.id)`, videoID)
+	if err != nil {
+		log.Printf("evaluateSavedSearches: query error video=%d: %v", videoID, err)
+		return
+	}
+	type saved struct {
+		id     int
+		params string
+	}
+	list := []saved{}
+	for rows.Next() {
+		var s saved
+		if err := rows.Scan(&s.id, &s.params); err == nil {
+			list = append(list, s)
+		}
+	}
+	rows.Close()
+	matched := 0
+	for _, s := range list {
+		lq := savedSearchQuery(s.params)
+		params := append(lq.Params, videoID)
+		var ok bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM (`+lq.SQL+`) x WHERE x.id = $`+strconv.Itoa(len(params))+`)`, params...).Scan(&ok); err != nil {
+			log.Printf("evaluateSavedSearches: search=%d video=%d: %v", s.id, videoID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if _, err := db.Exec("INSERT INTO saved_search_matches (saved_search_id, video_id) VALUES ($1,$2) ON CONFLICT DO NOTHING", s.id, videoID); err == nil {
+			matched++
+		}
+	}
+	if matched > 0 {
+		log.Printf("evaluateSavedSearches: video=%d matched %d saved searches", videoID, matched)
+	}
+}
+
+// CreateSavedSearchHandler saves a filter set: {"name": "...", "params": "q=...&tags=..."}.
+func CreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	var req struct {
+		Name   string `json:"name"`
+		Params string `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректный запрос", http.StatusBadRequest)
+		return
+	}
+	params := normalizeSavedSearchParams(req.Params)
+	if params == "" {
+		http.Error(w, "Нужен хотя бы один фильтр", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = params
+	}
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	var count int
+	_ = db.QueryRow("SELECT COUNT(*) FROM saved_searches WHERE user_id=$1", uid).Scan(&count)
+	if count >= maxSavedSearchesPerUser {
+		http.Error(w, "Слишком много сохранённых поисков", http.StatusBadRequest)
+		return
+	}
+	s := SavedSearch{Name: name, Params: params}
+	err := db.QueryRow(`INSERT INTO saved_searches (user_id, name, params) VALUES ($1,$2,$3)
+        ON CONFLICT (user_id, params) DO UPDATE SET name = EXCLUDED.name
+        RETURNING id, created_at, last_seen_at`, uid, name, params).Scan(&s.ID, &s.CreatedAt, &s.LastSeenAt)
+	if err != nil {
+		log.Printf("CreateSavedSearchHandler: insert error user=%d: %v", uid, err)
+		http.Error(w, "Ошибка сохранения поиска", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// ListSavedSearchesHandler lists the user's saved searches with the number of new matches.
+func ListSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	rows, err := db.Query(`SELECT s.id, s.name, s.params, s.created_at, s.last_seen_at,
+            (SELECT COUNT(*) FROM saved_search_matches m JOIN videos v ON v.id = m.video_id
+             WHERE m.saved_search_id = s.id AND m.matched_at > s.last_seen_at AND v.is_approved = TRUE)
+        FROM saved_searches s WHERE s.user_id=$1 ORDER BY s.created_at DESC`, uid)
+	if err != nil {
+		http.Error(w, "Ошибка получения поисков", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []SavedSearch{}
+	for rows.Next() {
+		var s SavedSearch
+		if err := rows.Scan(&s.ID, &s.Name, &s.Params, &s.CreatedAt, &s.LastSeenAt, &s.NewCount); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DeleteSavedSearchHandler removes a saved search of the current user.
+func DeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	res, err := db.Exec("DELETE FROM saved_searches WHERE id=$1 AND user_id=$2", id, uid)
+	if err != nil {
+		http.Error(w, "Ошибка удаления", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Поиск не найден", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// encodeSavedSearchCursor keeps the matched_at window of the first page and the next offset, so
+// later pages list the same matches after last_seen_at has moved on.
+func encodeSavedSearchCursor(since, until time.Time, offset int) string {
+	return encodeCursor(listCursor{Sort: "saved_new", Values: []string{
+		since.Format(time.RFC3339Nano), until.Format(time.RFC3339Nano), strconv.Itoa(offset)}})
+}
+
+func decodeSavedSearchCursor(s string) (since, until time.Time, offset int, err error) {
+	c, err := decodeCursor(s)
+	if err != nil || c.Sort != "saved_new" || len(c.Values) != 3 {
+		return since, until, 0, fmt.Errorf("invalid cursor")
+	}
+	if since, err = time.Parse(time.RFC3339Nano, c.Values[0]); err != nil {
+		return since, until, 0, err
+	}
+	if until, err = time.Parse(time.RFC3339Nano, c.Values[1]); err != nil {
+		return since, until, 0, err
+	}
+	if offset, err = strconv.Atoi(c.Values[2]); err != nil || offset < 0 {
+		return since, until, 0, fmt.Errorf("invalid cursor")
+	}
+	return since, until, offset, nil
+}
+
+// SavedSearchNewVideosHandler returns videos matched since the last visit, newest first, and marks
+// them all as seen; the rest of a long list is paged with next_cursor. ?peek=1 leaves last_seen_at
+// unchanged; ?limit= as in listings.
+func SavedSearchNewVideosHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	limit, err := parsePageLimit(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	// database clock, so that matches recorded while this request runs are not skipped
+	var since, now time.Time
+	if err := db.QueryRow("SELECT last_seen_at, NOW()::timestamp FROM saved_searches WHERE id=$1 AND user_id=$2", id, uid).Scan(&since, &now); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Поиск не найден", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	offset := 0
+	cursor := strings.TrimSpace(r.URL.Query().Get("cursor"))
+	if cursor != "" {
+		if since, now, offset, err = decodeSavedSearchCursor(cursor); err != nil {
+			http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+			return
+		}
+	}
+	rows, err := db.Query(`SELECT `+videoListColumns+`
+        FROM saved_search_matches m
+        JOIN videos v ON v.id = m.video_id
+        `+videoListJoins+`
+        WHERE m.saved_search_id = $1 AND m.matched_at > $2 AND m.matched_at <= $3 AND v.is_approved = TRUE
+        ORDER BY m.matched_at DESC, v.id DESC
+        LIMIT `+strconv.Itoa(limit+1)+` OFFSET `+strconv.Itoa(offset), id, since, now)
+	if err != nil {
+		log.Printf("SavedSearchNewVideosHandler: query error search=%d: %v", id, err)
+		http.Error(w, "Ошибка получения видео", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := []Video{}
+	for rows.Next() {
+		var v Video
+		if err := scanVideo(rows, &v); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, v)
+	}
+	next := ""
+	if len(out) > limit {
+		out = out[:limit]
+		next = encodeSavedSearchCursor(since, now, offset+limit)
+	}
+	// the whole window is handed out through the cursor, so it counts as seen at once
+	if cursor == "" && !isTruthy(r.URL.Query().Get("peek")) {
+		_, _ = db.Exec("UPDATE saved_searches SET last_seen_at=$1 WHERE id=$2", now, id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": out, "next_cursor": next, "since": since})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeSavedSearchParams(t *testing.T) {
+	got := normalizeSavedSearchParams("?tags=%23кроссовки&category=7&cursor=abc&limit=10")
+	if want := "category=7&tags=%23%D0%BA%D1%80%D0%BE%D1%81%D1%81%D0%BE%D0%B2%D0%BA%D0%B8"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := normalizeSavedSearchParams("sort=likes&legacy=1"); got != "" {
+		t.Fatalf("sort alone is not a filter, got %q", got)
+	}
+}
+
+func TestNormalizeSavedSearchParamsDropsMinRating(t *testing.T) {
+	if got := normalizeSavedSearchParams("min_rating=5&q=%D0%BA%D0%BE%D1%82"); got != "q=%D0%BA%D0%BE%D1%82" {
+		t.Fatalf("got %q", got)
+	}
+	if got := normalizeSavedSearchParams("min_rating=5&sort=new"); got != "" {
+		t.Fatalf("min_rating alone is not a saved filter, got %q", got)
+	}
+}
+
+func TestSavedSearchCursorRoundTrip(t *testing.T) {
+	since := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	until := since.Add(time.Hour)
+	s, u, off, err := decodeSavedSearchCursor(encodeSavedSearchCursor(since, until, 24))
+	if err != nil || !s.Equal(since) || !u.Equal(until) || off != 24 {
+		t.Fatalf("got %v %v %d %v", s, u, off, err)
+	}
+	if _, _, _, err := decodeSavedSearchCursor(encodeOffsetCursor("history", 3)); err == nil {
+		t.Fatalf("foreign cursor must be rejected")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	pq "github.com/lib/pq"
+)
+
+// Typo-tolerant matching of the lowercased query $1 (pg_trgm): word similarity against the title,
+// plain similarity against tag names without the leading '#'.
+const (
+	fuzzyMatchSQL = `($1 <% LOWER(v.title) OR EXISTS (
+                SELECT 1 FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+                WHERE vt.video_id = v.id AND LTRIM(t.name, '#') % $1))`
+	fuzzyRankSQL = `GREATEST(word_similarity($1, LOWER(v.title)),
+                         COALESCE((SELECT MAX(similarity(LTRIM(t.name, '#'), $1))
+                                   FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE vt.video_id = v.id), 0))::float8`
+)
+
+// addSearchTerms adds the title words and tags of an approved video to search_terms, the
+// trigram-indexed vocabulary behind did-you-mean. Terms are kept when videos go away: they only
+// feed suggestions, never results.
+func addSearchTerms(videoID int) {
+	if _, err := db.Exec(`INSERT INTO search_terms (term)
+        SELECT LOWER(tok) FROM videos v CROSS JOIN LATERAL regexp_split_to_table(v.title, '[^[:alnum:]]+') AS tok
+        WHERE v.id = $1 AND v.is_approved = TRUE AND LENGTH(tok) > 2
+        UNION
+        SELECT LTRIM(t.name, '#') FROM video_tags vt
+        JOIN tags t ON t.id = vt.tag_id
+        JOIN videos v ON v.id = vt.video_id
+        WHERE vt.video_id = $1 AND v.is_approved = TRUE AND LTRIM(t.name, '#') <> ''
+        ON CONFLICT DO NOTHING`, videoID); err != nil {
+		log.Printf("addSearchTerms: video=%d: %v", videoID, err)
+	}
+}
+
+// searchWords splits a query into lowercased words, dropping punctuation and websearch operators.
+func searchWords(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// suggestCorrection replaces every query word by its most similar known term (search_terms and
+// category names).
+// It returns "" when no word could be improved.
+func suggestCorrection(q string) (string, error) {
+	words := searchWords(q)
+	if len(words) == 0 || len(words) > 10 {
+		return "", nil
+	}
+	rows, err := db.Query(`WITH words AS (SELECT w, ord FROM UNNEST($1::text[]) WITH ORDINALITY AS t(w, ord))
+        SELECT COALESCE((SELECT term FROM (
+                SELECT term FROM search_terms WHERE term % words.w
+                UNION SELECT LOWER(name) FROM categories WHERE LOWER(name) % words.w
+            ) vocab ORDER BY similarity(term, words.w) DESC, term ASC LIMIT 1), words.w)
+        FROM words ORDER BY ord`, pq.Array(words))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	fixed := make([]string, 0, len(words))
+	for rows.Next() {
+		var term string
+		if err := rows.Scan(&term); err != nil {
+			return "", err
+		}
+		fixed = append(fixed, term)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	out := strings.Join(fixed, " ")
+	if out == strings.Join(words, " ") {
+		return "", nil
+	}
+	return out, nil
+}
+
+// SearchSuggestion is one completion of a partial query.
+type SearchSuggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`         // title, tag or category
+	ID   int    `json:"id,omitempty"` // category or video id
+}
+
+// SearchSuggestHandler completes ?q= from popular titles, tags and categories (up to 10 items).
+// Prefix matches come first; when there are none, similar terms are offered instead.
+func SearchSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	q = strings.TrimLeft(q, "#")
+	out := []SearchSuggestion{}
+	if q == "" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+		return
+	}
+	if runes := []rune(q); len(runes) > 100 {
+		q = string(runes[:100])
+	}
+	pattern := escapeLike(q) + "%"
+	rows, err := db.Query(`(SELECT 'category' AS kind, c.name, c.id
+            FROM categories c WHERE LOWER(c.name) LIKE $1
+            ORDER BY c.position ASC, c.name ASC LIMIT 3)
+        UNION ALL
+        (SELECT 'tag', t.name, 0
+            FROM tags t JOIN video_tags vt ON vt.tag_id = t.id JOIN videos v ON v.id = vt.video_id AND v.is_approved = TRUE
+            WHERE LTRIM(t.name, '#') LIKE $1
+              AND NOT EXISTS (SELECT 1 FROM banned_tags b WHERE b.tag = t.name)
+            GROUP BY t.name ORDER BY COUNT(*) DESC, t.name ASC LIMIT 4)
+        UNION ALL
+        (SELECT 'title', v.title, v.id
+            FROM videos v WHERE v.is_approved = TRUE AND LOWER(v.title) LIKE $1
+            ORDER BY v.views_count DESC, v.id DESC LIMIT 5)`, pattern)
+	if err == nil {
+		out, err = scanSuggestions(rows, out)
+	}
+	if err == nil && len(out) == 0 && len([]rune(q)) >= 3 {
+		rows, err = db.Query(`(SELECT 'tag' AS kind, t.name, 0
+                FROM tags t WHERE LTRIM(t.name, '#') % $1
+                  AND NOT EXISTS (SELECT 1 FROM banned_tags b WHERE b.tag = t.name)
+                ORDER BY similarity(LTRIM(t.name, '#'), $1) DESC LIMIT 5)
+            UNION ALL
+            (SELECT 'title', v.title, v.id
+                FROM videos v WHERE v.is_approved = TRUE AND $1 <% LOWER(v.title)
+                ORDER BY word_similarity($1, LOWER(v.title)) DESC, v.views_count DESC LIMIT 5)`, q)
+		if err == nil {
+			out, err = scanSuggestions(rows, out)
+		}
+	}
+	if err != nil {
+		log.Printf("SearchSuggestHandler: query error: %v", err)
+		http.Error(w, "Ошибка получения подсказок", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func scanSuggestions(rows *sql.Rows, out []SearchSuggestion) ([]SearchSuggestion, error) {
+	defer rows.Close()
+	for rows.Next() {
+		var s SearchSuggestion
+		if err := rows.Scan(&s.Type, &s.Text, &s.ID); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
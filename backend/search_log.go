@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+// normalizeSearchQuery lowercases q and collapses whitespace so that equal searches group together.
+func normalizeSearchQuery(q string) string {
+	q = strings.Join(strings.Fields(strings.ToLower(q)), " ")
+	if runes := []rune(q); len(runes) > 200 {
+		q = string(runes[:200])
+	}
+	return q
+}
+
+// searchUserID is the current user as a nullable column value.
+func searchUserID(r *http.Request) sql.NullInt64 {
+	if uid, ok := r.Context().Value(ctxKeyUserID).(int); ok {
+		return sql.NullInt64{Int64: int64(uid), Valid: true}
+	}
+	return sql.NullInt64{}
+}
+
+// logSearch records a first-page listing request with a text query q (tags and categories are
+// kept as its filters; plain tag pages and category browsing are not searches) and returns the
+// log id (0 when nothing was logged). The total result count is filled in asynchronously.
+func logSearch(r *http.Request, lq videoListQuery, fuzzy bool) int64 {
+	query := normalizeSearchQuery(r.URL.Query().Get("q"))
+	if query == "" {
+		return 0
+	}
+	tags := parseTags(r.URL.Query().Get("tags"))
+	cats := append([]int64(nil), lq.SelectedCats...)
+	sort.Slice(cats, func(i, j int) bool { return cats[i] < cats[j] })
+	var id int64
+	if err := db.QueryRow(`INSERT INTO search_log (query, tags, category_ids, fuzzy, user_id, client_key)
+        VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		query, pq.Array(tags), pq.Array(cats), fuzzy, searchUserID(r), clientKey(r)).Scan(&id); err != nil {
+		log.Printf("logSearch: insert error: %v", err)
+		return 0
+	}
+	go func(inner string, params []any) {
+		if _, err := db.Exec(`UPDATE search_log SET results = (SELECT COUNT(*) FROM (`+inner+`) x)
+            WHERE id = $`+strconv.Itoa(len(params)+1), append(params, id)...); err != nil {
+			log.Printf("logSearch: count error id=%d: %v", id, err)
+		}
+	}(lq.SQL, append([]any(nil), lq.Params...))
+	return id
+}
+
+// recordSearchClick marks the search that led to opening a video (first click only). The search
+// must belong to the caller: their user id, or the client key of an anonymous search.
+func recordSearchClick(searchID string, videoID int, userID sql.NullInt64, clientKey string) {
+	sid, err := strconv.ParseInt(searchID, 10, 64)
+	if err != nil || sid <= 0 {
+		return
+	}
+	if _, err := db.Exec(`UPDATE search_log SET clicked_video_id=$1, clicked_at=NOW()
+        WHERE id=$2 AND clicked_at IS NULL AND created_at > NOW() - INTERVAL '1 day'
+          AND (user_id = $3 OR (user_id IS NULL AND client_key = $4))`, videoID, sid, userID, clientKey); err != nil {
+		log.Printf("recordSearchClick: update error id=%d: %v", sid, err)
+	}
+}
+
+// startSearchLogPruner deletes search_log rows older than SEARCH_LOG_RETENTION_DAYS (default 90) once a day.
+func startSearchLogPruner() {
+	days := 90
+	if v := strings.TrimSpace(os.Getenv("SEARCH_LOG_RETENTION_DAYS")); v != "" {
+		if x, err := strconv.Atoi(v); err == nil && x > 0 {
+			days = x
+		}
+	}
+	t := time.NewTicker(24 * time.Hour)
+	defer t.Stop()
+	for {
+		if res, err := db.Exec("DELETE FROM search_log WHERE created_at < NOW() - make_interval(days => $1)", days); err != nil {
+			log.Printf("search log: prune error: %v", err)
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("search log: pruned %d rows", n)
+		}
+		<-t.C
+	}
+}
+
+// searchReportParams reads ?days= (default 7, max 365) and ?limit= (default 50, max 500).
+func searchReportParams(r *http.Request) (days, limit int) {
+	days, limit = 7, 50
+	if v, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("days"))); err == nil && v > 0 {
+		if v > 365 {
+			v = 365
+		}
+		days = v
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("limit"))); err == nil && v > 0 {
+		if v > 500 {
+			v = 500
+		}
+		limit = v
+	}
+	return days, limit
+}
+
+type SearchQueryStat struct {
+	Query        string    `json:"query"`
+	Searches     int       `json:"searches"`
+	Users        int       `json:"users"`
+	AvgResults   float64   `json:"avg_results"`
+	Clicks       int       `json:"clicks"`
+	CTR          float64   `json:"ctr"`
+	LastSearched time.Time `json:"last_searched_at"`
+}
+
+// querySearchStats aggregates text queries of the last days; having filters the groups.
+func querySearchStats(days, limit int, having, order string) ([]SearchQueryStat, error) {
+	rows, err := db.Query(`SELECT query, COUNT(*),
+            COUNT(DISTINCT user_id),
+            COALESCE(AVG(results), 0)::float8,
+            COUNT(clicked_at),
+            COUNT(clicked_at)::float8 / COUNT(*),
+            MAX(created_at)
+        FROM search_log
+        WHERE query <> '' AND created_at > NOW() - make_interval(days => $1)
+        GROUP BY query
+        `+having+`
+        ORDER BY `+order+`
+        LIMIT $2`, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SearchQueryStat{}
+	for rows.Next() {
+		var s SearchQueryStat
+		if err := rows.Scan(&s.Query, &s.Searches, &s.Users, &s.AvgResults, &s.Clicks, &s.CTR, &s.LastSearched); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// AdminTopSearchesHandler lists the most frequent text queries with their click-through rate.
+func AdminTopSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	days, limit := searchReportParams(r)
+	out, err := querySearchStats(days, limit, "", "COUNT(*) DESC, query ASC")
+	if err != nil {
+		log.Printf("AdminTopSearchesHandler: query error: %v", err)
+		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// AdminZeroResultSearchesHandler lists frequent queries that found nothing, even with fuzzy matching.
+func AdminZeroResultSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	days, limit := searchReportParams(r)
+	out, err := querySearchStats(days, limit, "HAVING MAX(results) = 0", "COUNT(*) DESC, MAX(created_at) DESC")
+	if err != nil {
+		log.Printf("AdminZeroResultSearchesHandler: query error: %v", err)
+		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// AdminSearchClickThroughHandler returns overall and per-day click-through of logged searches.
+func AdminSearchClickThroughHandler(w http.ResponseWriter, r *http.Request) {
+	days, _ := searchReportParams(r)
+	type dayStat struct {
+		Day      string  `json:"day"`
+		Searches int     `json:"searches"`
+		Clicks   int     `json:"clicks"`
+		CTR      float64 `json:"ctr"`
+	}
+	rows, err := db.Query(`SELECT TO_CHAR(DATE_TRUNC('day', created_at), 'YYYY-MM-DD'), COUNT(*), COUNT(clicked_at)
+        FROM search_log
+        WHERE created_at > NOW() - make_interval(days => $1)
+        GROUP BY 1 ORDER BY 1`, days)
+	if err != nil {
+		log.Printf("AdminSearchClickThroughHandler: query error: %v", err)
+		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	resp := struct {
+		Searches int       `json:"searches"`
+		Clicks   int       `json:"clicks"`
+		CTR      float64   `json:"ctr"`
+		Days     []dayStat `json:"days"`
+	}{Days: []dayStat{}}
+	for rows.Next() {
+		var d dayStat
+		if err := rows.Scan(&d.Day, &d.Searches, &d.Clicks); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		if d.Searches > 0 {
+			d.CTR = float64(d.Clicks) / float64(d.Searches)
+		}
+		resp.Searches += d.Searches
+		resp.Clicks += d.Clicks
+		resp.Days = append(resp.Days, d)
+	}
+	if resp.Searches > 0 {
+		resp.CTR = float64(resp.Clicks) / float64(resp.Searches)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
+)
+
+const shareCodeAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// shareCodeLength gives ~5e11 codes over the alphabet above, without look-alike characters.
+const shareCodeLength = 7
+
+// shareDedupeWindow is how long repeated shares of one link to one channel by the same sharer,
+// and repeated clicks of one link by the same client, count once.
+const shareDedupeWindow = time.Hour
+
+// shareChannels are where a link was shared to; "copy" covers copied links pasted anywhere.
+var shareChannels = map[string]bool{"telegram": true, "whatsapp": true, "copy": true}
+
+func newShareCode() (string, error) {
+	b := make([]byte, shareCodeLength)
+	max := big.NewInt(int64(len(shareCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = shareCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// sharePreviewAgents are substrings of the user agents of link preview crawlers; their fetches of a
+// short link are not clicks.
+var sharePreviewAgents = []string{"telegrambot", "whatsapp", "facebookexternalhit", "twitterbot",
+	"slackbot", "discordbot", "vkshare", "linkedinbot", "skypeuripreview", "bot", "crawler", "spider"}
+
+// isPreviewAgent reports whether ua belongs to a link preview crawler or another bot.
+func isPreviewAgent(ua string) bool {
+	ua = strings.ToLower(ua)
+	for _, s := range sharePreviewAgents {
+		if strings.Contains(ua, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// shareReferrerHosts map referrer hosts (and their subdomains) to channels.
+var shareReferrerHosts = map[string]string{
+	"t.me": "telegram", "telegram.org": "telegram",
+	"wa.me": "whatsapp", "whatsapp.com": "whatsapp",
+}
+
+// shareChannelFromReferrer guesses the channel of a click that came without ?c=.
+func shareChannelFromReferrer(ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "copy"
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for domain, channel := range shareReferrerHosts {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return channel
+		}
+	}
+	return "copy"
+}
+
+// shareBaseURL is PUBLIC_BASE_URL, or the scheme and host the request came through.
+func shareBaseURL(r *http.Request) string {
+	if base := strings.TrimRight(strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL")), "/"); base != "" {
+		return base
+	}
+	scheme := "http"
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	} else if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ShareVideoHandler returns the short link of a video for the current sharer (one code per video
+// and user; anonymous sharers share one code per video) and counts the share, once per sharer
+// and channel within shareDedupeWindow (anonymous sharers are told apart by clientKey).
+// Body: { channel: telegram|whatsapp|copy }
+func ShareVideoHandler(w http.ResponseWriter, r *http.Request) {
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректные данные", http.StatusBadRequest)
+		return
+	}
+	channel := strings.ToLower(strings.TrimSpace(req.Channel))
+	if channel == "" {
+		channel = "copy"
+	}
+	if !shareChannels[channel] {
+		http.Error(w, "Недопустимый канал", http.StatusBadRequest)
+		return
+	}
+	var approved bool
+	if err := db.QueryRow("SELECT is_approved FROM videos WHERE id=$1", vid).Scan(&approved); err != nil || !approved {
+		http.Error(w, "Видео не найдено", http.StatusNotFound)
+		return
+	}
+	var sharer sql.NullInt32
+	sharerKey := clientKey(r)
+	if uid, ok := r.Context().Value(ctxKeyUserID).(int); ok {
+		sharer = sql.NullInt32{Int32: int32(uid), Valid: true}
+		sharerKey = "user:" + strconv.Itoa(uid)
+	}
+	var linkID int
+	var code string
+	// retry only on the rare collision of a fresh code with an existing one
+	for attempt := 0; ; attempt++ {
+		fresh, err := newShareCode()
+		if err != nil {
+			http.Error(w, "Ошибка сервера", http.StatusInternalServerError)
+			return
+		}
+		err = db.QueryRow(`INSERT INTO share_links (code, video_id, user_id) VALUES ($1,$2,$3)
+            ON CONFLICT (video_id, COALESCE(user_id, 0)) DO UPDATE SET video_id = EXCLUDED.video_id
+            RETURNING id, code`, fresh, vid, sharer).Scan(&linkID, &code)
+		if err == nil {
+			break
+		}
+		if pe, ok := err.(*pq.Error); ok && pe.Code.Name() == "unique_violation" && attempt < 3 {
+			continue
+		}
+		log.Printf("ShareVideoHandler: link error video=%d: %v", vid, err)
+		http.Error(w, "Не удалось создать ссылку", http.StatusInternalServerError)
+		return
+	}
+	if _, err := db.Exec(`INSERT INTO share_events (link_id, video_id, channel, sharer_key)
+        SELECT $1, $2, $3, $4
+        WHERE NOT EXISTS (SELECT 1 FROM share_events e WHERE e.link_id = $1 AND e.channel = $3
+            AND e.sharer_key = $4 AND e.created_at > NOW() - make_interval(secs => $5))`,
+		linkID, vid, channel, sharerKey, shareDedupeWindow.Seconds()); err != nil {
+		log.Printf("ShareVideoHandler: event error link=%d: %v", linkID, err)
+	}
+	path := "/s/" + code + "?c=" + channel
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"code": code, "channel": channel, "path": path, "url": shareBaseURL(r) + path})
+}
+
+// ShareRedirectHandler resolves /s/{code}, records the click with its channel and referrer and
+// redirects to the video page. Link previews are not recorded, and repeated clicks of one link by
+// the same client count once within shareDedupeWindow.
+func ShareRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+	var linkID, vid int
+	if err := db.QueryRow("SELECT id, video_id FROM share_links WHERE code=$1", code).Scan(&linkID, &vid); err != nil {
+		http.Error(w, "Ссылка не найдена", http.StatusNotFound)
+		return
+	}
+	referrer := r.Referer()
+	channel := strings.ToLower(r.URL.Query().Get("c"))
+	if !shareChannels[channel] {
+		channel = shareChannelFromReferrer(referrer)
+	}
+	if len(referrer) > 500 {
+		referrer = referrer[:500]
+	}
+	if !isPreviewAgent(r.UserAgent()) {
+		clickerKey := clientKey(r)
+		go func() {
+			if _, err := db.Exec(`INSERT INTO share_clicks (link_id, video_id, channel, referrer, clicker_key)
+                SELECT $1, $2, $3, $4, $5
+                WHERE NOT EXISTS (SELECT 1 FROM share_clicks c WHERE c.link_id = $1 AND c.clicker_key = $5
+                    AND c.created_at > NOW() - make_interval(secs => $6))`,
+				linkID, vid, channel, referrer, clickerKey, shareDedupeWindow.Seconds()); err != nil {
+				log.Printf("ShareRedirectHandler: click error link=%d: %v", linkID, err)
+			}
+		}()
+	}
+	http.Redirect(w, r, "/video/"+strconv.Itoa(vid), http.StatusFound)
+}
+
+// ShareChannelStats counts shares and resulting clicks of one channel.
+type ShareChannelStats struct {
+	Channel string `json:"channel"`
+	Shares  int    `json:"shares"`
+	Clicks  int    `json:"clicks"`
+}
+
+// TopSharer is a user whose links brought the most clicks.
+type TopSharer struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	Clicks int    `json:"clicks"`
+}
+
+// VideoShareStatsHandler shows the video owner (or an admin) how the video spreads: totals and
+// per-channel counts of shares and clicks, and the sharers that brought the most clicks.
+func VideoShareStatsHandler(w http.ResponseWriter, r *http.Request) {
+	vid, _ := strconv.Atoi(mux.Vars(r)["id"])
+	uid := r.Context().Value(ctxKeyUserID).(int)
+	role := r.Context().Value(ctxKeyUserRole).(string)
+	var owner int
+	if err := db.QueryRow("SELECT user_id FROM videos WHERE id=$1", vid).Scan(&owner); err != nil {
+		http.Error(w, "Видео не найдено", http.StatusNotFound)
+		return
+	}
+	if owner != uid && role != "admin" {
+		http.Error(w, "Нет прав", http.StatusForbidden)
+		return
+	}
+	rows, err := db.Query(`SELECT ch,
+            (SELECT COUNT(*) FROM share_events e WHERE e.video_id = $1 AND e.channel = ch),
+            (SELECT COUNT(*) FROM share_clicks c WHERE c.video_id = $1 AND c.channel = ch)
+        FROM unnest($2::text[]) ch`, vid, pq.Array([]string{"telegram", "whatsapp", "copy"}))
+	if err != nil {
+		log.Printf("VideoShareStatsHandler: channels error video=%d: %v", vid, err)
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	channels := []ShareChannelStats{}
+	shares, clicks := 0, 0
+	for rows.Next() {
+		var s ShareChannelStats
+		if err := rows.Scan(&s.Channel, &s.Shares, &s.Clicks); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		shares += s.Shares
+		clicks += s.Clicks
+		channels = append(channels, s)
+	}
+	srows, err := db.Query(`SELECT u.id, COALESCE(u.name,''), COUNT(*) AS clicks
+        FROM share_clicks c
+        JOIN share_links l ON l.id = c.link_id
+        JOIN users u ON u.id = l.user_id
+        WHERE c.video_id = $1
+        GROUP BY u.id ORDER BY clicks DESC, u.id LIMIT 10`, vid)
+	if err != nil {
+		log.Printf("VideoShareStatsHandler: sharers error video=%d: %v", vid, err)
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	defer srows.Close()
+	sharers := []TopSharer{}
+	for srows.Next() {
+		var s TopSharer
+		if err := srows.Scan(&s.UserID, &s.Name, &s.Clicks); err != nil {
+			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
+			return
+		}
+		sharers = append(sharers, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"video_id":     vid,
+		"shares_count": shares,
+		"clicks_count": clicks,
+		"channels":     channels,
+		"top_sharers":  sharers,
+	})
+}
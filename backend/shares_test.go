@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestShareChannelFromReferrer(t *testing.T) {
+	for ref, want := range map[string]string{
+		"https://t.me/somechannel":            "telegram",
+		"https://web.telegram.org/k/":         "telegram",
+		"https://wa.me/79990001122":           "whatsapp",
+		"https://web.whatsapp.com/":           "whatsapp",
+		"https://example.com/?from=t.me":      "copy",
+		"https://telegram.example.com/":       "copy",
+		"https://notwhatsapp.com/":            "copy",
+		"https://reelsup.ru/video/1#whatsapp": "copy",
+		"":                                    "copy",
+	} {
+		if got := shareChannelFromReferrer(ref); got != want {
+			t.Errorf("%q: got %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestIsPreviewAgent(t *testing.T) {
+	for _, ua := range []string{"TelegramBot (like TwitterBot)", "WhatsApp/2.23.20.0", "facebookexternalhit/1.1"} {
+		if !isPreviewAgent(ua) {
+			t.Errorf("%q should be a preview agent", ua)
+		}
+	}
+	if isPreviewAgent("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148") {
+		t.Errorf("a browser is not a preview agent")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
+)
+
+const (
+	maxTagsPerVideo = 30
+	maxTagLength    = 64
+)
+
+// normalizeTag lowercases a tag and ensures the leading '#'. Returns "" for empty tags.
+func normalizeTag(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	t = strings.TrimLeft(t, "#")
+	if t == "" {
+		return ""
+	}
+	if runes := []rune(t); len(runes) > maxTagLength {
+		t = string(runes[:maxTagLength])
+	}
+	return "#" + t
+}
+
+// parseTags splits the free-text tags field into unique normalized tags, keeping input order.
+func parseTags(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	out := []string{}
+	seen := map[string]bool{}
+	for _, f := range fields {
+		t := normalizeTag(f)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+		if len(out) >= maxTagsPerVideo {
+			break
+		}
+	}
+	return out
+}
+
+// syncVideoTags replaces the normalized tag links of a video with the tags parsed from raw.
+func syncVideoTags(videoID int, raw string) error {
+	tags := parseTags(raw)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM video_tags WHERE video_id=$1", videoID); err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		if _, err := tx.Exec("INSERT INTO tags (name) SELECT UNNEST($1::text[]) ON CONFLICT (name) DO NOTHING", pq.Array(tags)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO video_tags (video_id, tag_id)
+            SELECT $1, id FROM tags WHERE name = ANY($2::text[]) ON CONFLICT DO NOTHING`, videoID, pq.Array(tags)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TagVideosHandler lists approved videos with the exact tag; same response as ListVideosHandler.
+func TagVideosHandler(w http.ResponseWriter, r *http.Request) {
+	tag := normalizeTag(mux.Vars(r)["tag"])
+	if tag == "" {
+		http.Error(w, "Тег обязателен", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	q.Set("tags", tag)
+	r.URL.RawQuery = q.Encode()
+	// используем уже готовую логику выборки
+	ListVideosHandler(w, r)
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func scanTagCounts(rows *sql.Rows) ([]TagCount, error) {
+	defer rows.Close()
+	out := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, tc)
+	}
+	return out, rows.Err()
+}
+
+// ListTagsHandler returns the most used tags among approved videos.
+func ListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l := strings.TrimSpace(r.URL.Query().Get("limit")); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			if v > 200 {
+				v = 200
+			}
+			limit = v
+		}
+	}
+	rows, err := db.Query(`SELECT t.name, COUNT(*) AS cnt
+        FROM tags t
+        JOIN video_tags vt ON vt.tag_id = t.id
+        JOIN videos v ON v.id = vt.video_id AND v.is_approved = TRUE
+        WHERE NOT EXISTS (SELECT 1 FROM banned_tags b WHERE b.tag = t.name)
+        GROUP BY t.name
+        ORDER BY cnt DESC, t.name ASC
+        LIMIT $1`, limit)
+	if err != nil {
+		http.Error(w, "Ошибка получения тегов", http.StatusInternalServerError)
+		return
+	}
+	tags, err := scanTagCounts(rows)
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tags)
+}
+
+// escapeLike escapes LIKE wildcards typed by the user.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SuggestTagsHandler autocompletes tags by prefix for the upload form, most used first.
+func SuggestTagsHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := normalizeTag(r.URL.Query().Get("prefix"))
+	if prefix == "" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]TagCount{})
+		return
+	}
+	pattern := escapeLike(prefix) + "%"
+	rows, err := db.Query(`SELECT t.name, COUNT(v.id) AS cnt
+        FROM tags t
+        LEFT JOIN video_tags vt ON vt.tag_id = t.id
+        LEFT JOIN videos v ON v.id = vt.video_id AND v.is_approved = TRUE
+        WHERE t.name LIKE $1
+          AND NOT EXISTS (SELECT 1 FROM banned_tags b WHERE b.tag = t.name)
+        GROUP BY t.name
+        ORDER BY cnt DESC, t.name ASC
+        LIMIT 10`, pattern)
+	if err != nil {
+		http.Error(w, "Ошибка получения тегов", http.StatusInternalServerError)
+		return
+	}
+	tags, err := scanTagCounts(rows)
+	if err != nil {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tags)
+}
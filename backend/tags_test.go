@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	got := parseTags("#Shoe, shoes\n#SHOE  ##sale,,#")
+	want := "#shoe|#shoes|#sale"
+	if strings.Join(got, "|") != want {
+		t.Fatalf("parseTags()=%v, want %s", got, want)
+	}
+	if len(parseTags(strings.Repeat("a b c d e f g h i j k l m n o p q r s t u v w x y z aa bb cc dd ee ff ", 2))) != maxTagsPerVideo {
+		t.Fatalf("tags should be capped at %d", maxTagsPerVideo)
+	}
+}
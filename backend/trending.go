@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trendingScoreSQL recomputes the trending scores of approved videos into video_scores, kept apart
+// from videos so that the periodic rewrite does not touch the wide rows and their search indexes.
+// Engagement (views, likes, comments and ratings relative to the neutral 4 of 7, minus dislikes)
+// is divided by (age_hours + 2)^1.5 so that fresh activity outweighs an old like count.
+const trendingScoreSQL = `
+INSERT INTO video_scores (video_id, score)
+SELECT s.id, s.score
+FROM (
+    SELECT x.id,
+        GREATEST(
+            0.1 * x.views_count
+            + 2.0 * (SELECT COUNT(*) FROM likes l WHERE l.video_id = x.id)
+            - 1.5 * (SELECT COUNT(*) FROM dislikes d WHERE d.video_id = x.id)
+            + 3.0 * (SELECT COUNT(*) FROM comments m WHERE m.video_id = x.id AND NOT m.is_deleted)
+            + COALESCE((SELECT SUM(r.value - 4) FROM ratings r WHERE r.video_id = x.id), 0),
+            0
+        ) / POWER(EXTRACT(EPOCH FROM (NOW() - x.created_at)) / 3600.0 + 2, 1.5) AS score
+    FROM videos x
+    WHERE x.is_approved = TRUE
+) s
+ON CONFLICT (video_id) DO UPDATE SET score = EXCLUDED.score
+WHERE video_scores.score IS DISTINCT FROM EXCLUDED.score`
+
+// staleScoresSQL drops the scores of videos that are no longer approved.
+const staleScoresSQL = `
+DELETE FROM video_scores vs
+WHERE NOT EXISTS (SELECT 1 FROM videos v WHERE v.id = vs.video_id AND v.is_approved = TRUE)`
+
+func recalcTrendingScores() {
+	start := time.Now()
+	res, err := db.Exec(trendingScoreSQL)
+	if err != nil {
+		log.Printf("trending: recalculation error: %v", err)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if _, err := db.Exec(staleScoresSQL); err != nil {
+		log.Printf("trending: cleanup error: %v", err)
+	}
+	log.Printf("trending: updated %d scores in %s", n, time.Since(start).Round(time.Millisecond))
+}
+
+// startTrendingRecalculator refreshes trending scores now and then every TRENDING_INTERVAL_MIN (default 15) minutes.
+func startTrendingRecalculator() {
+	interval := 15 * time.Minute
+	if v := strings.TrimSpace(os.Getenv("TRENDING_INTERVAL_MIN")); v != "" {
+		if x, err := strconv.Atoi(v); err == nil && x > 0 {
+			interval = time.Duration(x) * time.Minute
+		}
+	}
+	recalcTrendingScores()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		recalcTrendingScores()
+	}
+}
@@ -1,19 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"image"
 	"io"
+	"log"
 	"net/http"
 	"net/mail"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
 	minio "github.com/minio/minio-go/v7"
 )
 
@@ -38,9 +42,9 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	var email, name, role string
+	var email, name, role, handle string
 	var avatarPath sql.NullString
-	if err := db.QueryRow("SELECT email, COALESCE(name,''), role, avatar_path FROM users WHERE id=$1", uid).Scan(&email, &name, &role, &avatarPath); err != nil {
+	if err := db.QueryRow("SELECT email, COALESCE(name,''), role, avatar_path, COALESCE(handle,'') FROM users WHERE id=$1", uid).Scan(&email, &name, &role, &avatarPath, &handle); err != nil {
 		http.Error(w, "Пользователь не найден", http.StatusNotFound)
 		return
 	}
@@ -49,12 +53,41 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		"id":         uid,
 		"email":      strings.ToLower(email),
 		"name":       name,
+		"handle":     handle,
 		"role":       role,
 		"avatar_url": buildAvatarURL(uid, avatarPath),
 	})
 }
 
-// UploadAvatarHandler accepts multipart/form-data with field "file" and stores avatar in MinIO.
+// avatarSizes are the square sizes generated on upload; the first one is stored under the base key.
+var avatarSizes = []int{512, 256, 128, 64}
+
+// avatarMaxPixels guards against decompression bombs before a full decode.
+const avatarMaxPixels = 40_000_000
+
+// avatarVariantKey returns the MinIO key of a resized avatar variant.
+func avatarVariantKey(baseKey string, size int) string {
+	if size == avatarSizes[0] {
+		return baseKey
+	}
+	return fmt.Sprintf("%s.%d.jpg", baseKey, size)
+}
+
+// removeAvatarObjects deletes a previously uploaded avatar with all its variants (best-effort).
+func removeAvatarObjects(ctx context.Context, bucket string, userID int, avatarPath sql.NullString) {
+	if !avatarPath.Valid || strings.TrimSpace(avatarPath.String) == "" || strings.HasPrefix(avatarPath.String, "/") {
+		return
+	}
+	for _, size := range avatarSizes {
+		if err := minioClient.RemoveObject(ctx, bucket, avatarVariantKey(avatarPath.String, size), minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("removeAvatarObjects: remove error user=%d key=%s: %v", userID, avatarPath.String, err)
+		}
+	}
+	removeDerivedImages(ctx, bucket, "avatar", userID)
+}
+
+// UploadAvatarHandler accepts multipart/form-data with field "file", validates it is a real image,
+// auto-orients it, crops to a square and stores several re-encoded sizes (without metadata) in MinIO.
 func UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
 	uid, ok := r.Context().Value(ctxKeyUserID).(int)
 	if !ok {
@@ -66,40 +99,70 @@ func UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Слишком большой запрос", http.StatusBadRequest)
 		return
 	}
-	file, hdr, err := r.FormFile("file")
+	file, _, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "Файл не найден", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(maxMB)<<20))
+	if err != nil {
+		http.Error(w, "Ошибка чтения файла", http.StatusBadRequest)
+		return
+	}
 
-	ct := hdr.Header.Get("Content-Type")
-	if !strings.HasPrefix(ct, "image/") {
+	// Do not trust the client Content-Type: sniff and decode the actual bytes
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
 		http.Error(w, "Только изображения", http.StatusBadRequest)
 		return
 	}
+	if cfg.Width*cfg.Height > avatarMaxPixels {
+		http.Error(w, "Слишком большое изображение", http.StatusBadRequest)
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Только изображения", http.StatusBadRequest)
+		return
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
 
-	// Generate key and upload
-	key := fmt.Sprintf("avatars/%d_%d%s", uid, time.Now().Unix(), strings.ToLower(filepath.Ext(hdr.Filename)))
 	bucket := os.Getenv("MINIO_BUCKET")
 	if bucket == "" {
 		bucket = "videos"
 	}
-	// We need the size for PutObject; stream into a temp buffer/file if size unknown
-	pr, pw := io.Pipe()
-	go func() {
-		defer pw.Close()
-		_, _ = io.Copy(pw, file)
-	}()
-	_, err = minioClient.PutObject(r.Context(), bucket, key, pr, -1, minio.PutObjectOptions{ContentType: ct})
-	if err != nil {
-		http.Error(w, "Ошибка сохранения аватара", http.StatusInternalServerError)
-		return
+	// Generate a fresh key per upload (derived images are cached by key) and upload every size;
+	// jpeg.Encode writes no EXIF/ICC metadata
+	key := fmt.Sprintf("avatars/%d_%d.jpg", uid, time.Now().UnixNano())
+	for _, size := range avatarSizes {
+		out, err := encodeImage(r.Context(), resizeImage(img, size, size), "jpeg")
+		if err != nil {
+			log.Printf("UploadAvatarHandler: encode error user=%d size=%d: %v", uid, size, err)
+			http.Error(w, "Ошибка обработки изображения", http.StatusInternalServerError)
+			return
+		}
+		vkey := avatarVariantKey(key, size)
+		if _, err := minioClient.PutObject(r.Context(), bucket, vkey, bytes.NewReader(out), int64(len(out)), minio.PutObjectOptions{ContentType: "image/jpeg"}); err != nil {
+			log.Printf("UploadAvatarHandler: PutObject error key=%s: %v", vkey, err)
+			http.Error(w, "Ошибка сохранения аватара", http.StatusInternalServerError)
+			return
+		}
 	}
+
+	var prev sql.NullString
+	_ = db.QueryRow("SELECT avatar_path FROM users WHERE id=$1", uid).Scan(&prev)
 	if _, err := db.Exec("UPDATE users SET avatar_path=$1 WHERE id=$2", key, uid); err != nil {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		removeAvatarObjects(ctx, bucket, uid, prev)
+	}()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"avatar_url": "/api/users/" + strconv.Itoa(uid) + "/avatar"})
 }
@@ -124,10 +187,21 @@ func SetPresetAvatarHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Недопустимый путь пресета", http.StatusBadRequest)
 		return
 	}
+	var prev sql.NullString
+	_ = db.QueryRow("SELECT avatar_path FROM users WHERE id=$1", uid).Scan(&prev)
 	if _, err := db.Exec("UPDATE users SET avatar_path=$1 WHERE id=$2", path, uid); err != nil {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "videos"
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		removeAvatarObjects(ctx, bucket, uid, prev)
+	}()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"avatar_url": path})
 }
@@ -143,6 +217,7 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name            *string `json:"name"`
 		Email           *string `json:"email"`
+		Handle          *string `json:"handle"`
 		PasswordConfirm string  `json:"password_confirm"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -150,8 +225,8 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Fetch current password hash and email
-	var curHash, curEmail, curName string
-	if err := db.QueryRow("SELECT password_hash, email, COALESCE(name,'') FROM users WHERE id=$1", uid).Scan(&curHash, &curEmail, &curName); err != nil {
+	var curHash, curEmail, curName, curHandle string
+	if err := db.QueryRow("SELECT password_hash, email, COALESCE(name,''), COALESCE(handle,'') FROM users WHERE id=$1", uid).Scan(&curHash, &curEmail, &curName, &curHandle); err != nil {
 		http.Error(w, "Пользователь не найден", http.StatusNotFound)
 		return
 	}
@@ -163,6 +238,7 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Prepare updates
 	newName := curName
 	newEmail := curEmail
+	newHandle := curHandle
 	if req.Name != nil {
 		newName = strings.TrimSpace(*req.Name)
 	}
@@ -178,13 +254,36 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		newEmail = email
 	}
+	if req.Handle != nil {
+		handle := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(*req.Handle), "@"))
+		if !validHandle(handle) {
+			http.Error(w, "Ник: 3-30 символов, латиница, цифры, _ и .", http.StatusBadRequest)
+			return
+		}
+		if reservedHandle(handle, uid) {
+			http.Error(w, "Этот ник зарезервирован", http.StatusBadRequest)
+			return
+		}
+		newHandle = handle
+	}
 	// Apply update
-	if _, err := db.Exec("UPDATE users SET name=$1, email=$2 WHERE id=$3", newName, newEmail, uid); err != nil {
+	if _, err := db.Exec("UPDATE users SET name=$1, email=$2, handle=NULLIF($3,'') WHERE id=$4", newName, newEmail, newHandle, uid); err != nil {
+		if pe, ok := err.(*pq.Error); ok && pe.Code.Name() == "unique_violation" {
+			http.Error(w, "Email или ник уже заняты", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "email": newEmail, "name": newName})
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "email": newEmail, "name": newName, "handle": newHandle})
+}
+
+// assignDefaultHandle gives a new account the handle user<id>; users can change it in the profile.
+func assignDefaultHandle(id int) {
+	if _, err := db.Exec("UPDATE users SET handle = 'user' || id WHERE id=$1 AND handle IS NULL", id); err != nil {
+		log.Printf("assignDefaultHandle: user %d: %v", id, err)
+	}
 }
 
 // UpdatePasswordHandler changes the current user's password.
@@ -236,7 +335,19 @@ func UpdatePasswordHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
 }
 
+// pickAvatarSize returns the smallest generated size that is at least the requested one.
+func pickAvatarSize(requested int) int {
+	best := avatarSizes[0]
+	for _, size := range avatarSizes {
+		if size >= requested && size < best {
+			best = size
+		}
+	}
+	return best
+}
+
 // UserAvatarContentHandler serves avatar content for a user when stored in MinIO (non-public path).
+// Optional ?size=N picks the closest generated variant not smaller than N.
 func UserAvatarContentHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
@@ -255,7 +366,17 @@ func UserAvatarContentHandler(w http.ResponseWriter, r *http.Request) {
 	if bucket == "" {
 		bucket = "videos"
 	}
-	obj, err := minioClient.GetObject(r.Context(), bucket, avatarPath.String, minio.GetObjectOptions{})
+	key := avatarPath.String
+	if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
+		if size, err := strconv.Atoi(sizeStr); err == nil && size > 0 {
+			vkey := avatarVariantKey(key, pickAvatarSize(size))
+			// legacy avatars were stored as a single raw object without variants
+			if _, err := minioClient.StatObject(r.Context(), bucket, vkey, minio.StatObjectOptions{}); err == nil {
+				key = vkey
+			}
+		}
+	}
+	obj, err := minioClient.GetObject(r.Context(), bucket, key, minio.GetObjectOptions{})
 	if err != nil {
 		http.Error(w, "Файл не найден", http.StatusNotFound)
 		return
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	pq "github.com/lib/pq"
 	minio "github.com/minio/minio-go/v7"
 )
 
@@ -39,52 +41,169 @@ type Video struct {
 	IsApproved         bool      `json:"is_approved"`
 	LikedByUser        bool      `json:"liked_by_user"`
 	DislikedByUser     bool      `json:"disliked_by_user"`
+	Favorited          bool      `json:"favorited"`
+	InWatchLater       bool      `json:"in_watch_later"`
 	Has720             bool      `json:"has_720"`
 	Has480             bool      `json:"has_480"`
 	AvgRating          float64   `json:"avg_rating"`
 	MyRating           int       `json:"my_rating"`
 	ViewsCount         int       `json:"views_count"`
+	SharesCount        int       `json:"shares_count"`
 	IsReel             bool      `json:"is_reel"`
+	TrendingScore      float64   `json:"trending_score,omitempty"`
+	DurationSeconds    float64   `json:"duration_seconds,omitempty"`
+	// where the viewer stopped last time (GetVideoHandler, authenticated and not finished)
+	ResumePosition *float64 `json:"resume_position,omitempty"`
+	// Bayesian average rating used by sort=rating
+	RatingScore float64 `json:"rating_score,omitempty"`
+	// Present only for full-text search results (q=...)
+	SearchRank     float64 `json:"search_rank,omitempty"`
+	TitleHighlight string  `json:"title_highlight,omitempty"`
+	Snippet        string  `json:"snippet,omitempty"`
 }
 
-func ListVideosHandler(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query().Get("q")
-	cat := r.URL.Query().Get("category")
-	catsCsv := r.URL.Query().Get("categories")
-	tagsCsv := r.URL.Query().Get("tags")
-	sort := r.URL.Query().Get("sort")
-	exclude := r.URL.Query().Get("exclude")
-	query := `SELECT v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
+// ts_headline markers: control characters that never appear in user text, so the
+// surrounding text can be HTML-escaped before they are turned into <mark> tags.
+const (
+	searchMarkStart    = "\x01"
+	searchMarkStop     = "\x02"
+	searchHeadlineOpts = "StartSel=" + searchMarkStart + ",StopSel=" + searchMarkStop
+)
+
+// highlightToHTML escapes a ts_headline result and converts its markers to <mark> tags.
+func highlightToHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, searchMarkStart, "<mark>")
+	return strings.ReplaceAll(s, searchMarkStop, "</mark>")
+}
+
+// videoListColumns is the column list behind the public Video JSON of listings.
+// Use it with videoListJoins (aliases v, u, c, pc, vs) and read rows with scanVideo.
+const videoListColumns = `v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
                      v.created_at, v.user_id, COALESCE(u.name,''),
-	                     v.category_id, COALESCE(c.name,''), COALESCE(pc.name,''),
+                     v.category_id, COALESCE(c.name,''), COALESCE(pc.name,''),
                      (SELECT COUNT(*) FROM likes l WHERE l.video_id = v.id)            AS likes,
                      (SELECT COUNT(*) FROM dislikes d WHERE d.video_id = v.id)         AS dislikes,
-                     (SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id)         AS comments,
+                     (SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id AND NOT m.is_deleted) AS comments,
                      COALESCE((SELECT AVG(value) FROM ratings r WHERE r.video_id = v.id),0) AS avg_rating,
                      v.is_approved,
                      (v.video_path_720 IS NOT NULL AND v.video_path_720 <> '') AS has_720,
                      (v.video_path_480 IS NOT NULL AND v.video_path_480 <> '') AS has_480,
                      v.views_count,
-                     v.is_reel
-              FROM videos v
-              JOIN users u ON u.id = v.user_id
-	              LEFT JOIN categories c ON c.id = v.category_id
-	              LEFT JOIN categories pc ON pc.id = c.parent_id
-              WHERE v.is_approved = TRUE`
+                     v.is_reel,
+                     COALESCE(vs.score, 0) AS trending_score,
+                     COALESCE(v.duration_seconds, 0) AS duration,
+                     ` + ratingScoreSQL + ` AS rating_score,
+                     (SELECT COUNT(*) FROM share_events se WHERE se.video_id = v.id) AS shares`
+
+// ratingScoreSQL is the Bayesian average of the 1..7 ratings: 5 virtual votes of the neutral 4
+// are mixed in, so a single 7-star vote does not outrank well-rated popular videos.
+const ratingScoreSQL = `(SELECT (5 * 4.0 + COALESCE(SUM(value), 0)) / (5 + COUNT(*)) FROM ratings r WHERE r.video_id = v.id)::float8`
+
+const videoListJoins = `JOIN users u ON u.id = v.user_id
+              LEFT JOIN categories c ON c.id = v.category_id
+              LEFT JOIN categories pc ON pc.id = c.parent_id
+              LEFT JOIN video_scores vs ON vs.video_id = v.id`
+
+// videoListDest returns the scan destinations matching videoListColumns.
+func videoListDest(v *Video, catID *sql.NullInt32) []any {
+	return []any{&v.ID, &v.Title, &v.Description, &v.Tags, &v.ProductLinks, &v.Thumbnail, &v.VideoPath,
+		&v.CreatedAt, &v.UserID, &v.UserName, catID, &v.CategoryName, &v.ParentCategoryName, &v.LikesCount, &v.DislikesCount, &v.CommentsCount, &v.AvgRating, &v.IsApproved, &v.Has720, &v.Has480, &v.ViewsCount, &v.IsReel, &v.TrendingScore, &v.DurationSeconds, &v.RatingScore, &v.SharesCount}
+}
+
+// videoDetailColumns is the column list of single-video responses and of the owner's own list,
+// which show unapproved videos too. Use it with videoDetailJoins and read rows into videoDetailDest.
+const videoDetailColumns = `v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
+                v.created_at, v.user_id, COALESCE(u.name,''),
+                v.category_id, COALESCE(c.name,''),
+                (SELECT COUNT(*) FROM likes l WHERE l.video_id = v.id)            AS likes,
+                (SELECT COUNT(*) FROM dislikes d WHERE d.video_id = v.id)         AS dislikes,
+                (SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id AND NOT m.is_deleted) AS comments,
+                COALESCE((SELECT AVG(value) FROM ratings r WHERE r.video_id = v.id),0) AS avg_rating,
+                v.is_approved,
+                (v.video_path_720 IS NOT NULL AND v.video_path_720 <> '') AS has_720,
+                (v.video_path_480 IS NOT NULL AND v.video_path_480 <> '') AS has_480,
+                v.views_count,
+                v.is_reel,
+                (SELECT COUNT(*) FROM share_events se WHERE se.video_id = v.id) AS shares`
+
+const videoDetailJoins = `JOIN users u ON u.id = v.user_id
+         LEFT JOIN categories c ON c.id = v.category_id`
+
+// videoDetailDest returns the scan destinations matching videoDetailColumns.
+func videoDetailDest(v *Video, catID *sql.NullInt32) []any {
+	return []any{&v.ID, &v.Title, &v.Description, &v.Tags, &v.ProductLinks, &v.Thumbnail, &v.VideoPath,
+		&v.CreatedAt, &v.UserID, &v.UserName, catID, &v.CategoryName, &v.LikesCount, &v.DislikesCount, &v.CommentsCount, &v.AvgRating, &v.IsApproved, &v.Has720, &v.Has480, &v.ViewsCount, &v.IsReel, &v.SharesCount}
+}
+
+// scanVideo reads one row selected with videoListColumns followed by optional extra columns.
+func scanVideo(rows *sql.Rows, v *Video, extra ...any) error {
+	var catID sql.NullInt32
+	if err := rows.Scan(append(videoListDest(v, &catID), extra...)...); err != nil {
+		return err
+	}
+	if catID.Valid {
+		v.CategoryID = int(catID.Int32)
+	}
+	return nil
+}
+
+// videoListQuery is a filtered listing query (without ORDER BY) built from request parameters.
+type videoListQuery struct {
+	SQL          string
+	Params       []any
+	Order        listSort
+	Search       bool // q is set: the rank, title highlight and snippet columns follow videoListColumns
+	Descendants  bool
+	SelectedCats []int64
+}
+
+// buildVideoListQuery translates the listing filters into SQL. With fuzzy set, q is matched by
+// trigram similarity on titles and tags instead of full-text search.
+func buildVideoListQuery(r *http.Request, fuzzy bool) videoListQuery {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	cat := r.URL.Query().Get("category")
+	catsCsv := r.URL.Query().Get("categories")
+	tagsCsv := r.URL.Query().Get("tags")
+	sort := r.URL.Query().Get("sort")
+	exclude := r.URL.Query().Get("exclude")
+	lq := videoListQuery{Search: q != ""}
 	params := []any{}
-	if q != "" {
-		like := "%" + q + "%"
-		query += " AND (v.title ILIKE $" + strconv.Itoa(len(params)+1)
-		params = append(params, like)
-		query += " OR v.description ILIKE $" + strconv.Itoa(len(params)+1)
-		params = append(params, like)
-		query += " OR v.tags ILIKE $" + strconv.Itoa(len(params)+1) + ")"
-		params = append(params, like)
+	// Full-text search: the parsed query is $1 and shared by filter, rank and headlines
+	searchCols := ""
+	searchFrom := ""
+	if q != "" && fuzzy {
+		params = append(params, strings.ToLower(q))
+		searchCols = `,
+                     ` + fuzzyRankSQL + ` AS rank,
+                     v.title,
+                     ''`
+	} else if q != "" {
+		params = append(params, q)
+		searchCols = `,
+                     ts_rank(v.search_tsv, sq.tsq)::float8 AS rank,
+                     ts_headline('russian', v.title, sq.tsq, '` + searchHeadlineOpts + `,HighlightAll=TRUE'),
+                     ts_headline('russian', COALESCE(v.description,''), sq.tsq, '` + searchHeadlineOpts + `,MaxFragments=2,MaxWords=30,MinWords=10')`
+		searchFrom = `
+              CROSS JOIN (SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS tsq) sq`
+	}
+	query := `SELECT ` + videoListColumns + searchCols + `
+              FROM videos v ` + videoListJoins + searchFrom + `
+              WHERE v.is_approved = TRUE`
+	if q != "" && fuzzy {
+		query += " AND " + fuzzyMatchSQL
+	} else if q != "" {
+		query += " AND v.search_tsv @@ sq.tsq"
 	}
+	// include_descendants=1 also matches videos filed under subcategories of the selected ones
+	lq.Descendants = isTruthy(r.URL.Query().Get("include_descendants"))
 	if cat != "" {
 		if cid, err := strconv.Atoi(cat); err == nil {
-			query += " AND v.category_id=$" + strconv.Itoa(len(params)+1)
-			params = append(params, cid)
+			lq.SelectedCats = append(lq.SelectedCats, int64(cid))
+			if !lq.Descendants {
+				query += " AND v.category_id=$" + strconv.Itoa(len(params)+1)
+				params = append(params, cid)
+			}
 		}
 	}
 	// multiple categories via categories=1,2,... (up to 20)
@@ -97,9 +216,10 @@ func ListVideosHandler(w http.ResponseWriter, r *http.Request) {
 			}
 			if x, err := strconv.Atoi(strings.TrimSpace(p)); err == nil {
 				ids = append(ids, x)
+				lq.SelectedCats = append(lq.SelectedCats, int64(x))
 			}
 		}
-		if len(ids) > 0 {
+		if len(ids) > 0 && !lq.Descendants {
 			placeholders := []string{}
 			for _, idv := range ids {
 				params = append(params, idv)
@@ -108,29 +228,20 @@ func ListVideosHandler(w http.ResponseWriter, r *http.Request) {
 			query += " AND v.category_id IN (" + strings.Join(placeholders, ",") + ")"
 		}
 	}
-	// tags filter via tags=tag1,tag2 (up to 20), OR-combined
+	if lq.Descendants && len(lq.SelectedCats) > 0 {
+		params = append(params, pq.Array(lq.SelectedCats))
+		query += " AND v.category_id IN (" + categorySubtreeSQL("$"+strconv.Itoa(len(params))) + ")"
+	}
+	// tags filter via tags=tag1,tag2 (up to 20), OR-combined, exact match on normalized tags
 	if tagsCsv != "" {
-		tokens := []string{}
-		for _, t := range strings.Split(tagsCsv, ",") {
-			t = strings.TrimSpace(t)
-			if t == "" {
-				continue
-			}
-			if !strings.HasPrefix(t, "#") {
-				t = "#" + t
-			}
-			tokens = append(tokens, t)
-			if len(tokens) >= 20 {
-				break
-			}
+		tokens := parseTags(tagsCsv)
+		if len(tokens) > 20 {
+			tokens = tokens[:20]
 		}
 		if len(tokens) > 0 {
-			ors := []string{}
-			for _, t := range tokens {
-				params = append(params, "%"+t+"%")
-				ors = append(ors, "v.tags ILIKE $"+strconv.Itoa(len(params)))
-			}
-			query += " AND (" + strings.Join(ors, " OR ") + ")"
+			params = append(params, pq.Array(tokens))
+			query += ` AND EXISTS (SELECT 1 FROM video_tags vt JOIN tags t ON t.id = vt.tag_id
+                WHERE vt.video_id = v.id AND t.name = ANY($` + strconv.Itoa(len(params)) + `::text[]))`
 		}
 	}
 	if exclude != "" {
@@ -139,61 +250,179 @@ func ListVideosHandler(w http.ResponseWriter, r *http.Request) {
 			params = append(params, exID)
 		}
 	}
-	if sort == "likes" {
-		query += " ORDER BY likes DESC, v.created_at DESC"
-	} else {
-		query += " ORDER BY v.created_at DESC"
+	query, params = appendVideoFilters(r, query, params)
+	lq.Order = videoSorts["new"]
+	if s, ok := videoSorts[sort]; ok && sort != "relevance" && sort != "fuzzy" {
+		lq.Order = s
+	} else if q != "" && (sort == "" || sort == "relevance") {
+		lq.Order = videoSorts["relevance"]
+		if fuzzy {
+			lq.Order = videoSorts["fuzzy"]
+		}
 	}
-	rows, err := db.Query(query, params...)
+	lq.SQL = query
+	lq.Params = params
+	return lq
+}
+
+// appendVideoFilters adds the optional attribute filters of video listings:
+// date_from/date_to (YYYY-MM-DD, inclusive, or RFC 3339), creator (user id), reels=only|exclude,
+// has_products=1, min_rating (average of 1..7) and min_duration/max_duration in seconds.
+// Malformed values are ignored like the other listing parameters.
+func appendVideoFilters(r *http.Request, query string, params []any) (string, []any) {
+	qv := r.URL.Query()
+	add := func(cond string, val any) {
+		params = append(params, val)
+		query += " AND " + strings.ReplaceAll(cond, "$?", "$"+strconv.Itoa(len(params)))
+	}
+	if t, ok := parseDateParam(qv.Get("date_from"), false); ok {
+		add("v.created_at >= $?", t)
+	}
+	if t, ok := parseDateParam(qv.Get("date_to"), true); ok {
+		add("v.created_at < $?", t)
+	}
+	if id, err := strconv.Atoi(strings.TrimSpace(qv.Get("creator"))); err == nil {
+		add("v.user_id = $?", id)
+	}
+	switch strings.ToLower(strings.TrimSpace(qv.Get("reels"))) {
+	case "only", "1", "true":
+		query += " AND v.is_reel = TRUE"
+	case "exclude", "0", "false":
+		query += " AND v.is_reel = FALSE"
+	}
+	if isTruthy(qv.Get("has_products")) {
+		query += " AND COALESCE(TRIM(v.product_links), '') <> ''"
+	}
+	if x, err := strconv.ParseFloat(strings.TrimSpace(qv.Get("min_rating")), 64); err == nil && x > 0 {
+		add("(SELECT AVG(value) FROM ratings r WHERE r.video_id = v.id) >= $?", x)
+	}
+	if x, err := strconv.ParseFloat(strings.TrimSpace(qv.Get("min_duration")), 64); err == nil && x > 0 {
+		add("v.duration_seconds >= $?", x)
+	}
+	if x, err := strconv.ParseFloat(strings.TrimSpace(qv.Get("max_duration")), 64); err == nil && x > 0 {
+		add("v.duration_seconds <= $?", x)
+	}
+	return query, params
+}
+
+// parseDateParam accepts YYYY-MM-DD or RFC 3339. A plain date used as an upper bound
+// means the end of that day, so it is returned as the start of the next one.
+func parseDateParam(s string, upper bool) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), true
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+// ListVideosHandler lists approved videos with search, category, tag filters and keyset pagination.
+// When a full-text search finds nothing on the first page, it retries with typo-tolerant trigram
+// matching and suggests a corrected query ("fuzzy" and "did_you_mean" in the envelope).
+func ListVideosHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	// fuzzy mode continues on later pages: their cursor carries the flag
+	fuzzy := q != "" && isTruthy(r.URL.Query().Get("fuzzy"))
+	if c, err := decodeCursor(strings.TrimSpace(r.URL.Query().Get("cursor"))); err == nil && c.Fuzzy {
+		fuzzy = q != ""
+	}
+	lq := buildVideoListQuery(r, fuzzy)
+	page, err := parsePageParams(r, lq.Order)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	out, err := queryVideoList(lq, page)
 	if err != nil {
 		log.Printf("ListVideosHandler: query error: %v", err)
 		http.Error(w, "Ошибка запроса видео", http.StatusInternalServerError)
 		return
 	}
+	didYouMean := ""
+	if len(out) == 0 && q != "" && !fuzzy && page.Cursor == nil {
+		fuzzy = true
+		lq = buildVideoListQuery(r, true)
+		if out, err = queryVideoList(lq, page); err != nil {
+			log.Printf("ListVideosHandler: fuzzy query error: %v", err)
+			http.Error(w, "Ошибка запроса видео", http.StatusInternalServerError)
+			return
+		}
+		if didYouMean, err = suggestCorrection(q); err != nil {
+			log.Printf("ListVideosHandler: did-you-mean error: %v", err)
+		}
+	}
+	// per-child counts for faceted navigation, computed once on the first page
+	var facets []CategoryFacet
+	if lq.Descendants && len(lq.SelectedCats) > 0 && page.Cursor == nil {
+		if facets, err = categoryFacets(lq.SQL, lq.Params, lq.SelectedCats); err != nil {
+			log.Printf("ListVideosHandler: facets error: %v", err)
+			http.Error(w, "Ошибка запроса видео", http.StatusInternalServerError)
+			return
+		}
+	}
+	page.Fuzzy = fuzzy
+	out, next := trimPage(out, lq.Order, page)
+	// search analytics; clients pass search_id back when a result is opened
+	var searchID int64
+	if page.Cursor == nil {
+		searchID = logSearch(r, lq, fuzzy)
+	}
+	if page.Legacy {
+		if searchID > 0 {
+			w.Header().Set("X-Search-Id", strconv.FormatInt(searchID, 10))
+		}
+		writeVideoPage(w, out, next, page)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(videoPage{Items: out, NextCursor: next, Facets: facets, Fuzzy: fuzzy, DidYouMean: didYouMean, SearchID: searchID})
+}
+
+// queryVideoList runs a paginated listing query and reads its rows.
+func queryVideoList(lq videoListQuery, page pageParams) ([]Video, error) {
+	query, params := paginateQuery(lq.SQL, lq.Params, lq.Order, page)
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 	out := []Video{}
 	for rows.Next() {
 		var v Video
-		var catID sql.NullInt32
-		if err := rows.Scan(&v.ID, &v.Title, &v.Description, &v.Tags, &v.ProductLinks, &v.Thumbnail, &v.VideoPath,
-			&v.CreatedAt, &v.UserID, &v.UserName, &catID, &v.CategoryName, &v.ParentCategoryName, &v.LikesCount, &v.DislikesCount, &v.CommentsCount, &v.AvgRating, &v.IsApproved, &v.Has720, &v.Has480, &v.ViewsCount, &v.IsReel); err != nil {
-			log.Printf("ListVideosHandler: scan error: %v, video ID: %v", err, v.ID)
-			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
-			return
+		var titleHL, snippet string
+		extra := []any{}
+		if lq.Search {
+			extra = append(extra, &v.SearchRank, &titleHL, &snippet)
 		}
-		if catID.Valid {
-			v.CategoryID = int(catID.Int32)
+		if err := scanVideo(rows, &v, extra...); err != nil {
+			return nil, fmt.Errorf("scan video %d: %w", v.ID, err)
+		}
+		if lq.Search {
+			v.TitleHighlight = highlightToHTML(titleHL)
+			v.Snippet = highlightToHTML(snippet)
 		}
 		out = append(out, v)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(out); err != nil {
-		log.Printf("ListVideosHandler: JSON encode error: %v", err)
-		http.Error(w, "Ошибка формирования ответа", http.StatusInternalServerError)
-	}
+	return out, rows.Err()
 }
 
 func GetVideoHandler(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 	var v Video
 	var catID sql.NullInt32
-	err := db.QueryRow(`SELECT v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
-                v.created_at, v.user_id, COALESCE(u.name,''),
-                v.category_id, COALESCE(c.name,''),
-                (SELECT COUNT(*) FROM likes l WHERE l.video_id = v.id)            AS likes,
-                (SELECT COUNT(*) FROM dislikes d WHERE d.video_id = v.id)         AS dislikes,
-                (SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id)         AS comments,
-                COALESCE((SELECT AVG(value) FROM ratings r WHERE r.video_id = v.id),0) AS avg_rating,
-                v.is_approved,
-                (v.video_path_720 IS NOT NULL AND v.video_path_720 <> '') AS has_720,
-                (v.video_path_480 IS NOT NULL AND v.video_path_480 <> '') AS has_480,
-                v.views_count,
-                v.is_reel
+	err := db.QueryRow(`SELECT `+videoDetailColumns+`
          FROM videos v
-         JOIN users u ON u.id = v.user_id
-         LEFT JOIN categories c ON c.id = v.category_id
-         WHERE v.id = $1`, id).Scan(&v.ID, &v.Title, &v.Description, &v.Tags, &v.ProductLinks, &v.Thumbnail, &v.VideoPath,
-		&v.CreatedAt, &v.UserID, &v.UserName, &catID, &v.CategoryName, &v.LikesCount, &v.DislikesCount, &v.CommentsCount, &v.AvgRating, &v.IsApproved, &v.Has720, &v.Has480, &v.ViewsCount, &v.IsReel)
+         `+videoDetailJoins+`
+         WHERE v.id = $1`, id).Scan(videoDetailDest(&v, &catID)...)
 	if err != nil {
 		log.Printf("GetVideoHandler: query error for id=%d: %v", id, err)
 		http.Error(w, "Видео не найдено", http.StatusNotFound)
@@ -224,10 +453,35 @@ func GetVideoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	v.LikedByUser = liked
 	v.DislikedByUser = disliked
+	if uid, ok := r.Context().Value(ctxKeyUserID).(int); ok {
+		v.ResumePosition = resumePosition(uid, v.ID)
+		_ = db.QueryRow(`SELECT COALESCE(BOOL_OR(list = $3), FALSE), COALESCE(BOOL_OR(list = $4), FALSE)
+            FROM video_bookmarks WHERE user_id=$1 AND video_id=$2`, uid, v.ID, listFavorites, listWatchLater).Scan(&v.Favorited, &v.InWatchLater)
+	}
+	if sid := r.URL.Query().Get("search_id"); sid != "" {
+		go recordSearchClick(sid, v.ID, searchUserID(r), clientKey(r))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(v)
 }
 
+// viewDedupeWindow is how long repeated playbacks of one video by the same viewer count once.
+const viewDedupeWindow = 30 * time.Minute
+
+// countView adds a view unless the viewer (user:<id> or clientKey) was counted for the video
+// within viewDedupeWindow.
+func countView(videoID int, viewer string) {
+	if _, err := db.Exec(`WITH counted AS (
+            INSERT INTO video_views (video_id, viewer_key) VALUES ($1, $2)
+            ON CONFLICT (video_id, viewer_key) DO UPDATE SET viewed_at = NOW()
+            WHERE video_views.viewed_at <= NOW() - make_interval(secs => $3)
+            RETURNING video_id)
+        UPDATE videos SET views_count = views_count + 1 WHERE id IN (SELECT video_id FROM counted)`,
+		videoID, viewer, viewDedupeWindow.Seconds()); err != nil {
+		log.Printf("countView: video=%d: %v", videoID, err)
+	}
+}
+
 func VideoContentHandler(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 	var orig, p720, p480 string
@@ -258,11 +512,6 @@ func VideoContentHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	// Increment views count (once per request)
-	go func() {
-		_, _ = db.Exec("UPDATE videos SET views_count = views_count + 1 WHERE id=$1", id)
-	}()
-
 	bucket := os.Getenv("MINIO_BUCKET")
 	if bucket == "" {
 		bucket = "videos"
@@ -273,6 +522,16 @@ func VideoContentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Файл не найден", http.StatusNotFound)
 		return
 	}
+	// Views are counted here rather than from watch history: anonymous viewers have no history and
+	// the player's media requests carry no token. Only the request that opens a playback counts
+	// (no Range, or a range from byte 0), not the seeks and buffering ranges that follow it.
+	if rh := r.Header.Get("Range"); rh == "" || strings.HasPrefix(rh, "bytes=0-") {
+		viewer := clientKey(r)
+		if uid, ok := r.Context().Value(ctxKeyUserID).(int); ok {
+			viewer = "user:" + strconv.Itoa(uid)
+		}
+		go countView(id, viewer)
+	}
 	rangeHeader := r.Header.Get("Range")
 	w.Header().Set("Accept-Ranges", "bytes")
 	if rangeHeader == "" {
@@ -400,21 +659,11 @@ func UploadVideoHandler(w http.ResponseWriter, r *http.Request) {
 	description := r.FormValue("description")
 	tags := r.FormValue("tags")
 	// Validate tags against banned list
-	if strings.TrimSpace(tags) != "" {
-		split := strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' })
-		for _, t := range split {
-			if t == "" {
-				continue
-			}
-			if !strings.HasPrefix(t, "#") {
-				t = "#" + t
-			}
-			t = strings.ToLower(t)
-			var x string
-			if err := db.QueryRow("SELECT tag FROM banned_tags WHERE tag=$1", t).Scan(&x); err == nil {
-				http.Error(w, "Запрещённый тег: "+t, http.StatusBadRequest)
-				return
-			}
+	for _, t := range parseTags(tags) {
+		var x string
+		if err := db.QueryRow("SELECT tag FROM banned_tags WHERE tag=$1", t).Scan(&x); err == nil {
+			http.Error(w, "Запрещённый тег: "+t, http.StatusBadRequest)
+			return
 		}
 	}
 	productLinks := r.FormValue("productLinks")
@@ -460,9 +709,24 @@ func UploadVideoHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка сохранения метаданных", http.StatusInternalServerError)
 		return
 	}
+	if err := syncVideoTags(videoID, tags); err != nil {
+		log.Printf("UploadVideoHandler: sync tags error video=%d: %v", videoID, err)
+	}
+	if isApproved {
+		go addSearchTerms(videoID)
+	}
 
 	go func() {
 		ctx := context.Background()
+		if dur, err := probeObjectDuration(ctx, bucket, objectName); err == nil {
+			_, _ = db.Exec("UPDATE videos SET duration_seconds=$1 WHERE id=$2", dur, videoID)
+		} else {
+			log.Printf("UploadVideoHandler: probe duration error video=%d: %v", videoID, err)
+		}
+		// auto-approved uploads notify saved searches right away (duration filters need the probe)
+		if isApproved {
+			evaluateSavedSearches(videoID)
+		}
 		if thumb, err := generatePreviewGIF(ctx, bucket, objectName); err == nil {
 			_, _ = db.Exec("UPDATE videos SET thumbnail_path=$1 WHERE id=$2", thumb, videoID)
 		}
@@ -500,6 +764,8 @@ func DeleteVideoHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	// cached related lists of other videos may still include this one
+	relatedCache.Clear()
 	bucket := os.Getenv("MINIO_BUCKET")
 	if bucket == "" {
 		bucket = "videos"
@@ -533,6 +799,7 @@ func DeleteVideoHandler(w http.ResponseWriter, r *http.Request) {
 		if thumb != "" {
 			remove(thumb + ".jpg")
 		}
+		removeDerivedImages(ctx, bkt, "thumbnail", id)
 	}(bucket, path, thumb, p720, p480)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Видео удалено"})
@@ -607,26 +874,21 @@ func UpdateVideoMetaHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	if req.Tags != nil {
+		if err := syncVideoTags(id, *req.Tags); err != nil {
+			log.Printf("UpdateVideoMetaHandler: sync tags error video=%d: %v", id, err)
+		}
+		go addSearchTerms(id)
+	}
+	relatedCache.Clear()
 
 	// Return updated brief info
 	var v Video
 	var catID sql.NullInt32
-	if err := db.QueryRow(`SELECT v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
-                v.created_at, v.user_id, COALESCE(u.name,''),
-                v.category_id, COALESCE(c.name,''),
-                (SELECT COUNT(*) FROM likes l WHERE l.video_id = v.id)            AS likes,
-                (SELECT COUNT(*) FROM dislikes d WHERE d.video_id = v.id)         AS dislikes,
-                (SELECT COUNT(*) FROM comments m WHERE m.video_id = v.id)         AS comments,
-                COALESCE((SELECT AVG(value) FROM ratings r WHERE r.video_id = v.id),0) AS avg_rating,
-                v.is_approved,
-                (v.video_path_720 IS NOT NULL AND v.video_path_720 <> '') AS has_720,
-                (v.video_path_480 IS NOT NULL AND v.video_path_480 <> '') AS has_480,
-                v.views_count
+	if err := db.QueryRow(`SELECT `+videoDetailColumns+`
          FROM videos v
-         JOIN users u ON u.id = v.user_id
-         LEFT JOIN categories c ON c.id = v.category_id
-         WHERE v.id = $1`, id).Scan(&v.ID, &v.Title, &v.Description, &v.Tags, &v.ProductLinks, &v.Thumbnail, &v.VideoPath,
-		&v.CreatedAt, &v.UserID, &v.UserName, &catID, &v.CategoryName, &v.LikesCount, &v.DislikesCount, &v.CommentsCount, &v.AvgRating, &v.IsApproved, &v.Has720, &v.Has480, &v.ViewsCount); err != nil {
+         `+videoDetailJoins+`
+         WHERE v.id = $1`, id).Scan(videoDetailDest(&v, &catID)...); err != nil {
 		http.Error(w, "Ошибка обновления", http.StatusInternalServerError)
 		return
 	}
@@ -701,17 +963,17 @@ func UndislikeVideoHandler(w http.ResponseWriter, r *http.Request) {
 
 func ListMyVideosHandler(w http.ResponseWriter, r *http.Request) {
 	uid := r.Context().Value(ctxKeyUserID).(int)
-	rows, err := db.Query(`SELECT v.id, v.title, v.description, v.tags, v.product_links, v.thumbnail_path, v.video_path,
-                v.created_at, v.user_id, COALESCE(u.name,''),
-                v.category_id, COALESCE(c.name,''),
-                (SELECT COUNT(*) FROM likes l WHERE l.video_id=v.id) as likes,
-                (SELECT COUNT(*) FROM dislikes d WHERE d.video_id=v.id) as dislikes,
-                (SELECT COUNT(*) FROM comments m WHERE m.video_id=v.id) as comments,
-                v.is_approved, (v.video_path_720 IS NOT NULL AND v.video_path_720 <> '') as has_720, (v.video_path_480 IS NOT NULL AND v.video_path_480 <> '') as has_480,
-                v.views_count
-         FROM videos v JOIN users u ON u.id=v.user_id
-         LEFT JOIN categories c ON c.id=v.category_id
-         WHERE v.user_id=$1 ORDER BY v.created_at DESC`, uid)
+	order := videoSorts["new"]
+	page, err := parsePageParams(r, order)
+	if err != nil {
+		http.Error(w, "Некорректные параметры страницы", http.StatusBadRequest)
+		return
+	}
+	query, params := paginateQuery(`SELECT `+videoDetailColumns+`
+         FROM videos v
+         `+videoDetailJoins+`
+         WHERE v.user_id=$1`, []any{uid}, order, page)
+	rows, err := db.Query(query, params...)
 	if err != nil {
 		http.Error(w, "Ошибка получения видео", http.StatusInternalServerError)
 		return
@@ -721,8 +983,7 @@ func ListMyVideosHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var v Video
 		var catID sql.NullInt32
-		if err := rows.Scan(&v.ID, &v.Title, &v.Description, &v.Tags, &v.ProductLinks, &v.Thumbnail, &v.VideoPath,
-			&v.CreatedAt, &v.UserID, &v.UserName, &catID, &v.CategoryName, &v.LikesCount, &v.DislikesCount, &v.CommentsCount, &v.AvgRating, &v.IsApproved, &v.Has720, &v.Has480, &v.ViewsCount); err != nil {
+		if err := rows.Scan(videoDetailDest(&v, &catID)...); err != nil {
 			http.Error(w, "Ошибка данных", http.StatusInternalServerError)
 			return
 		}
@@ -731,8 +992,8 @@ func ListMyVideosHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		out = append(out, v)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(out)
+	out, next := trimPage(out, order, page)
+	writeVideoPage(w, out, next, page)
 }
 
 // generatePreviewGIF creates an animated GIF preview from ~6 evenly-spaced frames of the video.
@@ -942,6 +1203,49 @@ func probeDuration(path string) (float64, error) {
 	return dur, nil
 }
 
+// probeObjectDuration runs ffprobe against a presigned URL, so only the container header is read.
+func probeObjectDuration(ctx context.Context, bucket, key string) (float64, error) {
+	u, err := minioClient.PresignedGetObject(ctx, bucket, key, 15*time.Minute, nil)
+	if err != nil {
+		return 0, err
+	}
+	return probeDuration(u.String())
+}
+
+// backfillVideoDurations fills duration_seconds of videos uploaded before it was recorded.
+// Failed probes are only logged and retried on the next start.
+func backfillVideoDurations() {
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "videos"
+	}
+	rows, err := db.Query("SELECT id, video_path FROM videos WHERE duration_seconds IS NULL ORDER BY id")
+	if err != nil {
+		log.Printf("backfillVideoDurations: query error: %v", err)
+		return
+	}
+	type item struct {
+		id   int
+		path string
+	}
+	items := []item{}
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.path); err == nil {
+			items = append(items, it)
+		}
+	}
+	rows.Close()
+	for _, it := range items {
+		dur, err := probeObjectDuration(context.Background(), bucket, it.path)
+		if err != nil {
+			log.Printf("backfillVideoDurations: video=%d: %v", it.id, err)
+			continue
+		}
+		_, _ = db.Exec("UPDATE videos SET duration_seconds=$1 WHERE id=$2", dur, it.id)
+	}
+}
+
 // transcodeVariants creates 720p and 480p variants and uploads to MinIO.
 func transcodeVariants(ctx context.Context, bucket, objectKey string) (string, string, error) {
 	dir, err := os.MkdirTemp("", "transcode")
@@ -1059,7 +1363,7 @@ func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	uid := r.Context().Value(ctxKeyUserID).(int)
 	role := r.Context().Value(ctxKeyUserRole).(string)
 	var author int
-	if err := db.QueryRow("SELECT user_id FROM comments WHERE id=$1 AND video_id=$2", commentId, videoId).Scan(&author); err != nil {
+	if err := db.QueryRow("SELECT COALESCE(user_id, 0) FROM comments WHERE id=$1 AND video_id=$2 AND is_deleted=FALSE", commentId, videoId).Scan(&author); err != nil {
 		http.Error(w, "Комментарий не найден", http.StatusNotFound)
 		return
 	}
@@ -1074,10 +1378,35 @@ func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Некорректный текст", http.StatusBadRequest)
 		return
 	}
-	if _, err := db.Exec("UPDATE comments SET text=$1 WHERE id=$2", req.Text, commentId); err != nil {
+	// keep the previous text in the edit history (visible to admins)
+	var editedAt sql.NullTime
+	err := db.QueryRow(`WITH old AS (
+            SELECT id, text FROM comments WHERE id=$2 AND text <> $1 FOR UPDATE
+        ), hist AS (
+            INSERT INTO comment_edits (comment_id, old_text, edited_by) SELECT id, text, $3 FROM old
+        )
+        UPDATE comments c SET text=$1, edited_at=NOW() FROM old WHERE c.id = old.id
+        RETURNING c.edited_at`, req.Text, commentId, uid).Scan(&editedAt)
+	if err == sql.ErrNoRows {
+		// text unchanged
+		err = db.QueryRow("SELECT edited_at FROM comments WHERE id=$1", commentId).Scan(&editedAt)
+	}
+	if err != nil {
 		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
 		return
 	}
+	// mentions follow the text: removed ones are dropped, only new ones notify
+	entities, err := syncCommentMentions(commentId, videoId, author, req.Text)
+	if err != nil {
+		log.Printf("UpdateCommentHandler: mentions of comment %d: %v", commentId, err)
+	}
+	resp := map[string]any{"id": commentId, "text": req.Text, "edited": editedAt.Valid}
+	if len(entities) > 0 {
+		resp["entities"] = entities
+	}
+	if editedAt.Valid {
+		resp["edited_at"] = editedAt.Time.Format(time.RFC3339)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"id": commentId, "text": req.Text})
+	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestHighlightToHTML(t *testing.T) {
+	in := "Новые " + searchMarkStart + "кроссовки" + searchMarkStop + " <b>Nike</b>"
+	want := "Новые <mark>кроссовки</mark> &lt;b&gt;Nike&lt;/b&gt;"
+	if got := highlightToHTML(in); got != want {
+		t.Fatalf("highlightToHTML()=%q, want %q", got, want)
+	}
+}
+
+func TestParseDateParam(t *testing.T) {
+	from, ok := parseDateParam("2024-03-01", false)
+	if !ok || from.Format("2006-01-02") != "2024-03-01" {
+		t.Fatalf("date_from parsed as %v %v", from, ok)
+	}
+	to, ok := parseDateParam("2024-03-01", true)
+	if !ok || to.Format("2006-01-02") != "2024-03-02" {
+		t.Fatalf("inclusive date_to should be the next day, got %v", to)
+	}
+	if _, ok := parseDateParam("01.03.2024", false); ok {
+		t.Fatalf("unsupported format should be ignored")
+	}
+}
+
+// selectColumnCount counts the top-level items of a SELECT column list.
+func selectColumnCount(cols string) int {
+	n, depth, quoted := 1, 0, false
+	for _, r := range cols {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			n++
+		}
+	}
+	return n
+}
+
+func TestVideoColumnsMatchScanDest(t *testing.T) {
+	var v Video
+	var catID sql.NullInt32
+	cases := []struct {
+		name string
+		cols string
+		dest []any
+	}{
+		{"videoListColumns", videoListColumns, videoListDest(&v, &catID)},
+		{"videoDetailColumns", videoDetailColumns, videoDetailDest(&v, &catID)},
+	}
+	for _, c := range cases {
+		if got := selectColumnCount(c.cols); got != len(c.dest) {
+			t.Errorf("%s selects %d columns, scanned into %d", c.name, got, len(c.dest))
+		}
+	}
+}
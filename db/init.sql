@@ -67,6 +67,43 @@ ALTER TABLE IF EXISTS videos
     ADD COLUMN IF NOT EXISTS is_reel BOOLEAN NOT NULL DEFAULT FALSE,
     ADD COLUMN IF NOT EXISTS is_approved BOOLEAN NOT NULL DEFAULT FALSE;
 
+-- length in seconds (ffprobe), used by duration sorts and filters
+ALTER TABLE IF EXISTS videos
+    ADD COLUMN IF NOT EXISTS duration_seconds DOUBLE PRECISION;
+
+-- full-text search: title (A) ranks above tags (B) and description (C); both russian and english stemming
+ALTER TABLE IF EXISTS videos
+    ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('russian', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('russian', COALESCE(tags, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(tags, '')), 'B') ||
+        setweight(to_tsvector('russian', COALESCE(description, '')), 'C') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_videos_search_tsv ON videos USING GIN (search_tsv);
+
+-- typo-tolerant search fallback and suggestions (trigram similarity)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_videos_title_trgm ON videos USING GIN (LOWER(title) gin_trgm_ops);
+
+-- did-you-mean vocabulary: title words and tags of approved videos, added by the backend on approval
+CREATE TABLE IF NOT EXISTS search_terms (
+    term TEXT PRIMARY KEY
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_terms_trgm ON search_terms USING GIN (term gin_trgm_ops);
+
+-- time-decayed engagement score of approved videos, refreshed periodically by the backend
+-- (sort=trending); a separate table so the refresh does not rewrite videos rows
+CREATE TABLE IF NOT EXISTS video_scores (
+    video_id INT PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_scores_score ON video_scores (score DESC);
+
 -- ensure avatar column exists on users for legacy databases
 ALTER TABLE IF EXISTS users
     ADD COLUMN IF NOT EXISTS avatar_path TEXT;
@@ -74,11 +111,56 @@ ALTER TABLE IF EXISTS users
 CREATE TABLE IF NOT EXISTS comments (
     id SERIAL PRIMARY KEY,
     video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
-    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
     text TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
+-- comments outlive their author's account, so that threads below them keep their parents
+ALTER TABLE IF EXISTS comments
+    ALTER COLUMN user_id DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS comments_user_id_fkey,
+    ADD CONSTRAINT comments_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- threaded replies (depth 0..2); deleted comments with replies stay as placeholders
+ALTER TABLE IF EXISTS comments
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES comments(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS depth SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_video ON comments(video_id, created_at) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_id, created_at);
+
+-- comment likes, the video owner's heart and one pinned comment per video
+CREATE TABLE IF NOT EXISTS comment_likes (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, comment_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_likes_comment ON comment_likes(comment_id);
+
+ALTER TABLE IF EXISTS comments
+    ADD COLUMN IF NOT EXISTS hearted_at TIMESTAMP;
+
+-- edits: previous versions of comment texts, visible to admins
+ALTER TABLE IF EXISTS comments
+    ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS comment_edits (
+    id SERIAL PRIMARY KEY,
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    old_text TEXT NOT NULL,
+    edited_by INT REFERENCES users(id) ON DELETE SET NULL,
+    edited_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_edits_comment ON comment_edits(comment_id, edited_at DESC);
+
+ALTER TABLE IF EXISTS videos
+    ADD COLUMN IF NOT EXISTS pinned_comment_id INT REFERENCES comments(id) ON DELETE SET NULL;
+
 CREATE TABLE IF NOT EXISTS likes (
     user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
@@ -107,6 +189,253 @@ CREATE TABLE IF NOT EXISTS banned_tags (
 -- PK already indexes tag; extra index redundant. Keep for legacy, but safe to skip.
 -- CREATE INDEX IF NOT EXISTS idx_banned_tags_tag ON banned_tags(tag);
 
+-- normalized tags (lowercase with leading '#'), linked to videos
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL
+);
+
+-- prefix autocomplete (LIKE 'abc%')
+CREATE INDEX IF NOT EXISTS idx_tags_name_prefix ON tags (name text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS video_tags (
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    tag_id INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (video_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_tags_tag ON video_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_tags_name_trgm ON tags USING GIN (LTRIM(name, '#') gin_trgm_ops);
+
+-- backfill from the legacy free-text videos.tags column (same rules as parseTags in the backend)
+INSERT INTO tags (name)
+SELECT DISTINCT '#' || LEFT(LOWER(LTRIM(tok, '#')), 64)
+FROM videos v CROSS JOIN LATERAL regexp_split_to_table(COALESCE(v.tags, ''), '[\s,]+') AS tok
+WHERE LTRIM(tok, '#') <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO video_tags (video_id, tag_id)
+SELECT DISTINCT v.id, t.id
+FROM videos v CROSS JOIN LATERAL regexp_split_to_table(COALESCE(v.tags, ''), '[\s,]+') AS tok
+JOIN tags t ON t.name = '#' || LEFT(LOWER(LTRIM(tok, '#')), 64)
+WHERE LTRIM(tok, '#') <> ''
+ON CONFLICT DO NOTHING;
+
+-- seed the did-you-mean vocabulary (same rules as addSearchTerms in the backend)
+INSERT INTO search_terms (term)
+SELECT LOWER(tok) FROM videos v CROSS JOIN LATERAL regexp_split_to_table(v.title, '[^[:alnum:]]+') AS tok
+WHERE v.is_approved = TRUE AND LENGTH(tok) > 2
+UNION
+SELECT LTRIM(t.name, '#') FROM video_tags vt
+JOIN tags t ON t.id = vt.tag_id
+JOIN videos v ON v.id = vt.video_id
+WHERE v.is_approved = TRUE AND LTRIM(t.name, '#') <> ''
+ON CONFLICT DO NOTHING;
+
+-- background zip exports of a creator's original uploads
+CREATE TABLE IF NOT EXISTS video_exports (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    object_key TEXT,
+    videos_count INT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_exports_user ON video_exports(user_id, created_at DESC);
+
+-- reels already served per viewer ("u:<user id>" or "s:<anonymous session token>")
+CREATE TABLE IF NOT EXISTS reel_impressions (
+    viewer TEXT NOT NULL,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    served_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (viewer, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_videos_reels ON videos (created_at DESC) WHERE is_approved = TRUE AND is_reel = TRUE;
+
+-- search analytics (normalized queries), pruned by the backend after SEARCH_LOG_RETENTION_DAYS
+CREATE TABLE IF NOT EXISTS search_log (
+    id BIGSERIAL PRIMARY KEY,
+    query TEXT NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    category_ids INT[] NOT NULL DEFAULT '{}',
+    results INT,
+    fuzzy BOOLEAN NOT NULL DEFAULT FALSE,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    clicked_video_id INT REFERENCES videos(id) ON DELETE SET NULL,
+    clicked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE search_log ADD COLUMN IF NOT EXISTS client_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_search_log_created ON search_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_search_log_query ON search_log(query, created_at);
+
+-- saved listing filters (normalized query string) and the approved videos they matched
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    params TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, params)
+);
+
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+    saved_search_id INT NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    matched_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (saved_search_id, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_search_matches_time ON saved_search_matches(saved_search_id, matched_at DESC);
+
+-- creator subscriptions
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_followee ON follows(followee_id);
+CREATE INDEX IF NOT EXISTS idx_videos_user_created ON videos(user_id, created_at DESC) WHERE is_approved = TRUE;
+
+-- @handles used for mentions; new accounts get user<id> until they pick one
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle TEXT;
+UPDATE users SET handle = 'user' || id WHERE handle IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_handle ON users(handle);
+
+-- blocked users cannot mention (or be mentioned by) the blocker
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+-- users resolved from @handles of a comment
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+-- in-app notifications (type: mention)
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    actor_id INT REFERENCES users(id) ON DELETE CASCADE,
+    video_id INT REFERENCES videos(id) ON DELETE CASCADE,
+    comment_id INT REFERENCES comments(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC);
+
+-- user playlists; share_key is the id used in shareable links
+CREATE TABLE IF NOT EXISTS playlists (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    share_key TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility TEXT NOT NULL DEFAULT 'private' CHECK (visibility IN ('private','unlisted','public')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlists_user ON playlists(user_id, updated_at DESC);
+
+CREATE TABLE IF NOT EXISTS playlist_items (
+    playlist_id INT NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    added_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (playlist_id, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlist_items_order ON playlist_items(playlist_id, position);
+
+-- per-user watch history with the last player position; recording can be paused
+ALTER TABLE users ADD COLUMN IF NOT EXISTS history_paused BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS watch_history (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    position_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    watched_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_watch_history_recent ON watch_history(user_id, watched_at DESC);
+
+-- favorites and watch-later lists, separate from likes
+CREATE TABLE IF NOT EXISTS video_bookmarks (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    list TEXT NOT NULL CHECK (list IN ('favorites','watch_later')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, list, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_bookmarks_recent ON video_bookmarks(user_id, list, created_at DESC);
+
+-- short share links: one code per video and sharer (NULL user_id = anonymous sharers)
+CREATE TABLE IF NOT EXISTS share_links (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_share_links_sharer ON share_links(video_id, COALESCE(user_id, 0));
+
+-- last counted view of a video per viewer (user:<id> or a client key), to debounce view counts
+CREATE TABLE IF NOT EXISTS video_views (
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    viewer_key TEXT NOT NULL,
+    viewed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (video_id, viewer_key)
+);
+
+-- every share action and every click on a short link; channel: telegram, whatsapp or copy
+CREATE TABLE IF NOT EXISTS share_events (
+    id SERIAL PRIMARY KEY,
+    link_id INT NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS share_clicks (
+    id SERIAL PRIMARY KEY,
+    link_id INT NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+    video_id INT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE share_events ADD COLUMN IF NOT EXISTS sharer_key TEXT;
+ALTER TABLE share_clicks ADD COLUMN IF NOT EXISTS clicker_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_share_events_video ON share_events(video_id, channel);
+CREATE INDEX IF NOT EXISTS idx_share_events_link ON share_events(link_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_share_clicks_video ON share_clicks(video_id, channel);
+CREATE INDEX IF NOT EXISTS idx_share_clicks_link ON share_clicks(link_id, clicker_key, created_at);
+
 INSERT INTO categories (name) VALUES 
 ('Одежда'), ('Животные'), ('Ювелирка'), ('Косметика'),
 ('Туризм'), ('Хоз.Товары'), ('Спорттовары')
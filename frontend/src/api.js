@@ -10,6 +10,19 @@ export async function apiGet(path) {
   return res.json();
 }
 
+// apiGetAll follows next_cursor of a paginated listing ({items, next_cursor}) and returns all items.
+export async function apiGetAll(path) {
+  const sep = path.includes('?') ? '&' : '?';
+  let items = [];
+  let cursor = '';
+  do {
+    const data = await apiGet(path + sep + 'limit=100' + (cursor ? '&cursor=' + encodeURIComponent(cursor) : ''));
+    items = items.concat(data.items || []);
+    cursor = data.next_cursor || '';
+  } while (cursor);
+  return items;
+}
+
 export async function apiPost(path, data) {
   const res = await fetch(path, {
     method: 'POST',
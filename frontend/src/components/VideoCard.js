@@ -3,14 +3,16 @@ import React, { useState } from 'react';
 import { Link } from 'react-router-dom';
 import { IconLike, IconDislike, IconEye, IconComment } from './Icons';
 
-export default function VideoCard({ video }) {
+// searchId is passed back to the API when the card was found through a search (click analytics)
+export default function VideoCard({ video, searchId }) {
+  const href = searchId ? `/video/${video.id}?search_id=${searchId}` : `/video/${video.id}`;
   const staticThumb = `/api/videos/${video.id}/thumbnail`;
   const animatedThumb = `/api/videos/${video.id}/thumbnail/animated`;
   const [src, setSrc] = useState(staticThumb);
 
   return (
     <div className="video-card">
-      <Link to={`/video/${video.id}`} className="thumb-wrap">
+      <Link to={href} className="thumb-wrap">
         <img
           src={src}
           alt={video.title}
@@ -19,7 +21,7 @@ export default function VideoCard({ video }) {
         />
       </Link>
       <div className="content">
-        <h3><Link to={`/video/${video.id}`}>{video.title}</Link></h3>
+        <h3><Link to={href}>{video.title}</Link></h3>
         <small>
           Автор: {video.user_name}
           {video.category_name && (
@@ -61,7 +61,7 @@ export default function VideoJSPlayer({
       const handler = () => {
         if (!playerRef.current) return;
         const current = playerRef.current.currentTime() || 0;
-        onTimeUpdate(current);
+        onTimeUpdate(current, playerRef.current.duration() || 0);
       };
       timeUpdateHandlerRef.current = handler;
       playerRef.current.on('timeupdate', handler);
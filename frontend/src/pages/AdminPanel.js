@@ -2,6 +2,7 @@ import React, { useEffect, useMemo, useRef, useState } from "react";
 import { useAuth } from "../contexts/AuthContext";
 import { useNavigate } from "react-router-dom";
 import VideoCard from "../components/VideoCard";
+import { apiGetAll } from "../api";
 import { IconShield, IconUser, IconUpload, IconDots } from "../components/Icons";
 
 export default function AdminPanel() {
@@ -71,13 +72,11 @@ export default function AdminPanel() {
       return;
     }
     // Pending videos for moderation
-    fetch("/api/admin/videos", { headers: authHeader() })
-      .then((r) => r.json())
+    apiGetAll("/api/admin/videos")
       .then((list) => setVideos(list))
       .catch(() => {});
     // Approved videos for management
-    fetch("/api/videos")
-      .then((r) => r.json())
+    apiGetAll("/api/videos")
       .then(setApprovedVideos)
       .catch(() => {});
     fetch("/api/admin/users", { headers: authHeader() })
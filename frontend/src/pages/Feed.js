@@ -17,6 +17,10 @@ export default function Feed() {
   const [selectedTags, setSelectedTags] = useState([]);
   const [categories, setCategories] = useState([]);
   const [sort, setSort] = useState('new');
+  const [listUrl, setListUrl] = useState('');
+  const [nextCursor, setNextCursor] = useState('');
+  const [loadingMore, setLoadingMore] = useState(false);
+  const [searchId, setSearchId] = useState(0);
 
   useEffect(() => {
     const sp = new URLSearchParams(location.search);
@@ -38,23 +42,41 @@ export default function Feed() {
   const load = ({ q:qq='', category:cc='', categories:catsArr=[], tags:tagsArr=[], sortBy=sort }={}) => {
     setLoading(true);
     let url = '/api/videos';
-    const params = [];
+    // reels have their own page and are kept out of the main feed
+    const params = ['reels=exclude'];
     if (qq) params.push('q='+encodeURIComponent(qq));
     if (cc) params.push('category='+cc);
     if (catsArr.length) params.push('categories='+catsArr.join(','));
+    // a parent category also shows videos of its subcategories
+    if (cc || catsArr.length) params.push('include_descendants=1');
     if (tagsArr.length) params.push('tags='+encodeURIComponent(tagsArr.join(',')));
-    if (sortBy === 'likes') params.push('sort=likes');
-    // exclude reels from main feed (handled on client if backend doesn't support filtering)
-    if (params.length) url += '?' + params.join('&');
+    if (sortBy && sortBy !== 'new') params.push('sort='+sortBy);
+    url += '?' + params.join('&');
     apiGet(url)
       .then(data => {
-        const nonReels = (data || []).filter(v => !(v.reel === 1 || v.reel === true || v.is_reel === 1 || v.is_reel === true));
-        setVideos(nonReels);
+        setVideos(data.items || []);
+        setListUrl(url);
+        setNextCursor(data.next_cursor || '');
+        setSearchId(data.search_id || 0);
         setLoading(false);
       })
       .catch(() => setLoading(false));
   };
 
+  // next page of the same listing (the API returns {items, next_cursor})
+  const loadMore = () => {
+    if (!nextCursor || loadingMore) return;
+    setLoadingMore(true);
+    const sep = listUrl.includes('?') ? '&' : '?';
+    apiGet(listUrl + sep + 'cursor=' + encodeURIComponent(nextCursor))
+      .then(data => {
+        setVideos(prev => [...prev, ...(data.items || [])]);
+        setNextCursor(data.next_cursor || '');
+      })
+      .catch(() => {})
+      .finally(() => setLoadingMore(false));
+  };
+
   const search = (e) => {
     e.preventDefault();
     const tokens = (q || '').split(/[\s,]+/).filter(Boolean).map(t => t.startsWith('#') ? t : ('#'+t));
@@ -131,6 +153,9 @@ export default function Feed() {
         <select value={sort} onChange={e=>{ const nextSort = e.target.value; setSort(nextSort); load({ q, category, categories:selectedCats, tags:selectedTags, sortBy: nextSort }); }}>
           <option value="new">Новые</option>
           <option value="likes">По лайкам</option>
+          <option value="rating">По рейтингу</option>
+          <option value="views">По просмотрам</option>
+          <option value="comments">По комментариям</option>
         </select>
         <button>Найти</button>
       </form>
@@ -158,8 +183,13 @@ export default function Feed() {
         <div className="feed">
           {loading
             ? Array.from({ length: 6 }).map((_, i) => <VideoSkeleton key={i} />)
-            : videos.map(v => <VideoCard key={v.id} video={v} />)}
+            : videos.map(v => <VideoCard key={v.id} video={v} searchId={searchId} />)}
         </div>
+        {!loading && nextCursor ? (
+          <div style={{ display:'flex', justifyContent:'center', margin:'16px 0' }}>
+            <button onClick={loadMore} disabled={loadingMore}>{loadingMore ? 'Загрузка…' : 'Показать ещё'}</button>
+          </div>
+        ) : null}
       </div>
     </div>
   );
@@ -1,7 +1,7 @@
 import React, { useCallback, useEffect, useMemo, useState } from 'react';
 import { useAuth } from '../contexts/AuthContext';
 import { useNavigate } from 'react-router-dom';
-import { apiDelete, apiGet, apiPost, apiPut, apiUpload } from '../api';
+import { apiDelete, apiGet, apiGetAll, apiPost, apiPut, apiUpload } from '../api';
 import VideoCard from '../components/VideoCard';
 import VideoUploadForm from '../components/VideoUploadForm';
 
@@ -67,7 +67,7 @@ export default function Profile() {
 
   useEffect(() => {
     if (!user) { nav('/login'); return; }
-    apiGet('/api/user/videos').then(setVideos).catch(()=>{});
+    apiGetAll('/api/user/videos').then(setVideos).catch(()=>{});
     loadStreams();
   }, [user, nav, loadStreams]);
 
@@ -1,5 +1,5 @@
 import React, { useEffect, useMemo, useState } from 'react';
-import { apiGet } from '../api';
+import { apiGetAll } from '../api';
 import LeftSidebar from '../components/LeftSidebar';
 import ShortsViewer from '../components/ShortsViewer';
 
@@ -11,10 +11,9 @@ export default function Shorts() {
 
   useEffect(() => {
     setLoading(true);
-    apiGet('/api/videos')
-      .then(data => {
-        const onlyReels = (data || []).filter(v => (v.reel === 1 || v.reel === true || v.is_reel === 1 || v.is_reel === true));
-        setVideos(onlyReels);
+    apiGetAll('/api/videos?reels=only')
+      .then(items => {
+        setVideos(items);
         setLoading(false);
       })
       .catch(() => setLoading(false));
@@ -1,8 +1,8 @@
 
 import React, { useEffect, useState, useRef, useCallback } from 'react';
-import { useParams, useNavigate } from 'react-router-dom';
+import { useParams, useNavigate, useLocation } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
-import { apiGet, apiPost, apiDelete } from '../api';
+import { apiGet, apiGetAll, apiPost, apiDelete } from '../api';
 import { IconCopy } from '../components/Icons';
 import VideoPlayer from '../components/VideoPlayer';
 import VideoCard from '../components/VideoCard';
@@ -10,9 +10,13 @@ import VideoCard from '../components/VideoCard';
 export default function VideoPage() {
   const { id } = useParams();
   const navigate = useNavigate();
+  const location = useLocation();
   const { user } = useAuth();
   const [video, setVideo] = useState(null);
   const [comments, setComments] = useState([]);
+  // loaded replies by parent comment id; a thread is open while its key is present
+  const [replies, setReplies] = useState({});
+  const [replyTo, setReplyTo] = useState(null);
   const [text, setText] = useState('');
   const [editingId, setEditingId] = useState(null);
   const [editText, setEditText] = useState('');
@@ -36,12 +40,15 @@ export default function VideoPage() {
   const playerAreaRef = useRef(null);
   const touchStateRef = useRef({ active: false, startX: 0, startY: 0, lastX: 0, lastY: 0 });
   const currentTimeRef = useRef(0);
+  const lastReportedRef = useRef({ id: null, time: 0 });
 
   const load = async () => {
     setErr('');
     let v;
     try {
-      v = await apiGet('/api/videos/' + id);
+      // search_id attributes the click to the search the video was opened from
+      const searchId = new URLSearchParams(location.search).get('search_id');
+      v = await apiGet('/api/videos/' + id + (searchId ? '?search_id=' + encodeURIComponent(searchId) : ''));
       setVideo(v);
     } catch {
       setErr('Видео не найдено или недоступно');
@@ -52,14 +59,16 @@ export default function VideoPage() {
     }
 
     try {
-      const c = await apiGet('/api/videos/' + id + '/comments');
+      const c = await apiGetAll('/api/videos/' + id + '/comments');
       setComments(c);
+      setReplies({});
+      setReplyTo(null);
     } catch {}
 
     try {
-      // recommendations: same category, exclude current, sort by likes
-      const rec = await apiGet(`/api/videos?category=${v.category_id || ''}&exclude=${id}&sort=likes`);
-      const filtered = rec.filter(x => x.id !== Number(id)).slice(0, 20);
+      // recommendations: similar by tags, category tree and creator
+      const rec = await apiGet(`/api/videos/${id}/related?limit=20`);
+      const filtered = (rec.items || []).filter(x => x.id !== Number(id)).slice(0, 20);
       setRecs(filtered);
       const knownIds = new Set([Number(id)]);
       historyStack.forEach(item => knownIds.add(Number(item.id)));
@@ -68,7 +77,7 @@ export default function VideoPage() {
     } catch {}
 
     const pendingResume = pendingResumeRef.current;
-    const storedResume = playbackPositionsRef.current[v.id] || 0;
+    const storedResume = playbackPositionsRef.current[v.id] || v.resume_position || 0;
     const nextResume = pendingResume != null ? pendingResume : storedResume;
     pendingResumeRef.current = null;
     setResumeTime(nextResume);
@@ -86,22 +95,59 @@ export default function VideoPage() {
   }, [id]);
   useEffect(() => { fetch('/api/categories').then(r=>r.json()).then(setCategories).catch(()=>{}); }, []);
 
+  // mapComments applies fn to top-level comments and loaded replies; fn returns null to drop one
+  const mapComments = (fn) => {
+    setComments(cs => cs.map(fn).filter(Boolean));
+    setReplies(rs => Object.fromEntries(Object.entries(rs).map(([k, list]) => [k, list.map(fn).filter(Boolean)])));
+  };
+
+  const loadReplies = async (cid) => {
+    try {
+      const list = await apiGetAll(`/api/videos/${id}/comments/${cid}/replies`);
+      setReplies(rs => ({ ...rs, [cid]: list }));
+    } catch {}
+  };
+  const toggleReplies = (c) => {
+    if (replies[c.id]) {
+      setReplies(rs => { const next = { ...rs }; delete next[c.id]; return next; });
+    } else {
+      loadReplies(c.id);
+    }
+  };
+
   const addComment = async (e) => {
     e.preventDefault();
     if (!user) { alert('Войдите'); return; }
     if (!text.trim()) return;
     try {
-      const c = await apiPost('/api/videos/' + id + '/comments', { text });
-      setComments([...comments, c]); setText('');
+      const c = await apiPost('/api/videos/' + id + '/comments', replyTo ? { text, parent_id: replyTo.id } : { text });
+      setText(''); setReplyTo(null);
+      if (!c.parent_id) { setComments([...comments, c]); return; }
+      // the server may attach a too deep reply to the thread above, so follow its parent_id
+      mapComments(x => x.id === c.parent_id ? { ...x, reply_count: x.reply_count + 1 } : x);
+      if (replies[c.parent_id]) {
+        setReplies(rs => ({ ...rs, [c.parent_id]: [...rs[c.parent_id], c] }));
+      } else {
+        loadReplies(c.parent_id);
+      }
     } catch {}
   };
 
-  const handleProgress = useCallback((time) => {
+  const handleProgress = useCallback((time, duration) => {
     currentTimeRef.current = time;
     if (video) {
       playbackPositionsRef.current[video.id] = time;
+      // watch history: report the position every 10 seconds of playback, and once near the end
+      const last = lastReportedRef.current;
+      const percent = duration > 0 ? Math.min(100, time / duration * 100) : null;
+      const finished = percent !== null && percent >= 95;
+      if (user && (last.id !== video.id || Math.abs(time - last.time) >= 10 || (finished && !last.finished))) {
+        lastReportedRef.current = { id: video.id, time, finished };
+        const body = percent !== null ? { position: time, percent } : { position: time };
+        apiPost('/api/videos/' + video.id + '/progress', body).catch(() => {});
+      }
     }
-  }, [video]);
+  }, [video, user]);
 
   const handleFullscreenChange = useCallback((value) => {
     setIsFullscreen(Boolean(value));
@@ -219,12 +265,18 @@ export default function VideoPage() {
     };
   }, [isFullscreen, handleSwipeUp, handleSwipeDown]);
 
-  const delComment = async (cid) => {
+  const delComment = async (c) => {
     if (!user) return;
     if (!window.confirm('Удалить комментарий?')) return;
     try {
-      await apiDelete('/api/videos/' + id + '/comments/' + cid);
-      setComments(comments.filter(c => c.id !== cid));
+      await apiDelete('/api/videos/' + id + '/comments/' + c.id);
+      // a comment with replies stays as a placeholder, like on the server
+      const removed = !c.reply_count;
+      mapComments(x => {
+        if (x.id === c.id) return removed ? null : { ...x, deleted: true, text: '', user: { id: 0, name: '' } };
+        if (removed && x.id === c.parent_id) return { ...x, reply_count: x.reply_count - 1 };
+        return x;
+      });
     } catch {}
   };
 
@@ -240,7 +292,7 @@ export default function VideoPage() {
         body: JSON.stringify({ text: editText })
       });
       if (res.ok) {
-        setComments(comments.map(c => c.id === editingId ? { ...c, text: editText } : c));
+        mapComments(c => c.id === editingId ? { ...c, text: editText, edited: true } : c);
         setEditingId(null); setEditText('');
       }
     } catch {}
@@ -259,6 +311,42 @@ export default function VideoPage() {
     setVideo({ ...video, my_rating: res.my_rating, avg_rating: res.avg_rating });
   };
 
+  const renderComment = (c, depth = 0) => (
+    <div key={c.id} className="comment" style={depth > 0 ? { marginLeft: 16, borderLeft: '2px solid #eee', paddingLeft: 8 } : undefined}>
+      {c.deleted ? (
+        <div style={{ color: '#8899aa' }}>Комментарий удалён</div>
+      ) : (
+        <>
+          <div><span className="comment-author">{c.user.name || 'Удалённый аккаунт'}</span>: <span>{c.text}</span>{c.edited && <small style={{ color: '#8899aa' }}> (изменено)</small>}</div>
+          <div style={{ fontSize: '.8em', color: '#8899aa' }}>{new Date(c.created_at).toLocaleString()}</div>
+        </>
+      )}
+      <div style={{ marginTop: 4 }}>
+        {user && !c.deleted && <button onClick={()=>setReplyTo(c)}>Ответить</button>}
+        {c.reply_count > 0 && (
+          <button onClick={()=>toggleReplies(c)} style={{ marginLeft: 6 }}>
+            {replies[c.id] ? 'Скрыть ответы' : `Ответы (${c.reply_count})`}
+          </button>
+        )}
+        {user && !c.deleted && (user.id === c.user.id || user.role === 'admin') && (
+          editingId === c.id ? (
+            <>
+              <input value={editText} onChange={e=>setEditText(e.target.value)} style={{ width:'70%' }} />
+              <button onClick={saveEdit} style={{ marginLeft: 6 }}>Сохранить</button>
+              <button onClick={()=>{setEditingId(null); setEditText('');}} style={{ marginLeft: 6 }}>Отмена</button>
+            </>
+          ) : (
+            <>
+              <button onClick={()=>startEdit(c)} style={{ marginLeft: 6 }}>Редактировать</button>
+              <button onClick={()=>delComment(c)} style={{ marginLeft: 6, background:'#e88' }}>Удалить</button>
+            </>
+          )
+        )}
+      </div>
+      {(replies[c.id] || []).map(r => renderComment(r, depth + 1))}
+    </div>
+  );
+
   if (err) return <p style={{ color:'red', textAlign:'center' }}>{err}</p>;
   if (!video) return <p style={{ textAlign:'center' }}>Загрузка...</p>;
   const commentsUI = (
@@ -354,12 +442,7 @@ export default function VideoPage() {
               <button onClick={()=>setDrawerOpen(false)}>Закрыть</button>
             </div>
             <div>
-              {comments.map(c => (
-                <div key={c.id} className="comment">
-                  <div><span className="comment-author">{c.user.name}</span>: <span>{c.text}</span></div>
-                  <div style={{ fontSize: '.8em', color: '#8899aa' }}>{new Date(c.created_at).toLocaleString()}</div>
-                </div>
-              ))}
+              {comments.map(c => renderComment(c))}
               {comments.length === 0 && <p>Комментариев пока нет.</p>}
             </div>
           </div>
@@ -367,32 +450,16 @@ export default function VideoPage() {
       )}
       <h3>Комментарии ({comments.length})</h3>
       <div>
-        {comments.map(c => (
-          <div key={c.id} className="comment">
-            <div><span className="comment-author">{c.user.name}</span>: <span>{c.text}</span></div>
-            <div style={{ fontSize: '.8em', color: '#8899aa' }}>{new Date(c.created_at).toLocaleString()}</div>
-            {user && (user.id === c.user.id || user.role === 'admin') && (
-              <div style={{ marginTop: 4 }}>
-                {editingId === c.id ? (
-                  <>
-                    <input value={editText} onChange={e=>setEditText(e.target.value)} style={{ width:'70%' }} />
-                    <button onClick={saveEdit} style={{ marginLeft: 6 }}>Сохранить</button>
-                    <button onClick={()=>{setEditingId(null); setEditText('');}} style={{ marginLeft: 6 }}>Отмена</button>
-                  </>
-                ) : (
-                  <>
-                    <button onClick={()=>startEdit(c)}>Редактировать</button>
-                    <button onClick={()=>delComment(c.id)} style={{ marginLeft: 6, background:'#e88' }}>Удалить</button>
-                  </>
-                )}
-              </div>
-            )}
-          </div>
-        ))}
+        {comments.map(c => renderComment(c))}
         {comments.length === 0 && <p>Комментариев пока нет.</p>}
       </div>
       {user ? (
         <form onSubmit={addComment} style={{ marginTop: 10 }}>
+          {replyTo && (
+            <div style={{ fontSize: '.9em', color: '#8899aa' }}>
+              Ответ для {replyTo.user.name || 'Удалённый аккаунт'} <button type="button" onClick={()=>setReplyTo(null)}>×</button>
+            </div>
+          )}
           <input value={text} onChange={e=>setText(e.target.value)} placeholder="Ваш комментарий..." style={{ width: '80%' }} />
           <button type="submit">Отправить</button>
         </form>